@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !windows
+
+package fs
+
+import "os"
+
+// Lock returns an error as this OS is not supported.
+func Lock(f *os.File) error {
+	return ErrUnsupportedOS
+}
+
+// Unlock returns an error as this OS is not supported.
+func Unlock(f *os.File) error {
+	return ErrUnsupportedOS
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Lock places an exclusive advisory lock on f, blocking until no other process holds it.
+func Lock(f *os.File) error {
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX) // #nosec G115
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// Unlock releases a lock placed by Lock.
+func Unlock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN) // #nosec G115
+}
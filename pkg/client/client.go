@@ -10,26 +10,61 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/adrg/xdg"
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
 	"github.com/perpetuallyhorni/tikwm/internal/fs"
 	"github.com/perpetuallyhorni/tikwm/pkg/config"
 	"github.com/perpetuallyhorni/tikwm/pkg/network"
 	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
 )
 
+// Feed orders accepted by the FeedOrder setting.
+const (
+	// FeedOrderOldest processes feeds from the oldest post to the newest, once the whole feed has been fetched
+	// and held in memory.
+	FeedOrderOldest = "oldest"
+	// FeedOrderNewest processes feeds from the newest post to the oldest, while the feed is being fetched.
+	FeedOrderNewest = "newest"
+)
+
+// musicDirName is the directory inside the download path where music shared by all creators is stored.
+const musicDirName = "_music"
+
 // Client is the main entry point for interacting with the tikwm library.
 type Client struct {
-	cfg    *config.Config
-	db     storage.Storer
-	logger *log.Logger
+	cfg       *config.Config
+	db        storage.Storer
+	logger    *log.Logger
+	backend   tikwm.Backend
+	sources   *sourceScheduler // Shared by the copies made by inSubdir.
+	fallbacks *fallbackLog     // Shared by the copies made by inSubdir.
+
+	// Optional stores implemented by db, or nil if it does not implement them.
+	music       storage.MusicStore
+	postSources storage.PostSourceStore
+	checkpoints storage.CheckpointStore
+	feedCache   storage.FeedCacheStore
+	qualities   storage.QualityStore
+	metadata    storage.MetadataStore
+	stats       storage.StatsStore
+
+	sharedPath string                        // Top-level download path for shared assets, set by inSubdir.
+	flat       bool                          // Store posts directly in the download path rather than in per-author directories.
+	filePrefix func(post *tikwm.Post) string // Optional prefix for post filenames, e.g. a playlist position.
 }
 
-// New creates a new Client.
+// New creates a new Client that talks to the API through tikwm.DefaultBackend.
 func New(cfg *config.Config, db storage.Storer, logger *log.Logger) (*Client, error) {
+	return NewWithBackend(cfg, db, logger, tikwm.DefaultBackend)
+}
+
+// NewWithBackend creates a new Client that talks to the API through the given backend.
+// This is mainly useful for pointing the client at a fake API such as tikwmtest.Server.
+func NewWithBackend(cfg *config.Config, db storage.Storer, logger *log.Logger, backend tikwm.Backend) (*Client, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
@@ -39,7 +74,26 @@ func New(cfg *config.Config, db storage.Storer, logger *log.Logger) (*Client, er
 	if logger == nil {
 		return nil, fmt.Errorf("logger cannot be nil")
 	}
-	return &Client{cfg: cfg, db: db, logger: logger}, nil
+	if backend == nil {
+		return nil, fmt.Errorf("backend cannot be nil")
+	}
+	tasks, _ := db.(storage.SourceTaskStore)
+	sources := newSourceScheduler(backend, tasks, logger, cfg.SourcePrefetch, cfg.RetryOn429)
+	c := &Client{cfg: cfg, db: db, logger: logger, backend: backend, sources: sources, fallbacks: &fallbackLog{}}
+	c.music, _ = db.(storage.MusicStore)
+	c.postSources, _ = db.(storage.PostSourceStore)
+	c.checkpoints, _ = db.(storage.CheckpointStore)
+	c.feedCache, _ = db.(storage.FeedCacheStore)
+	c.qualities, _ = db.(storage.QualityStore)
+	c.metadata, _ = db.(storage.MetadataStore)
+	c.stats, _ = db.(storage.StatsStore)
+	if cfg.DownloadMusic && c.music == nil {
+		logger.Printf("The database does not store music, so music will not be downloaded.")
+	}
+	if cfg.SavePostMetadata && c.metadata == nil {
+		logger.Printf("The database does not store post metadata, so metadata files will not be saved.")
+	}
+	return c, nil
 }
 
 // ProgressCallback defines the function signature for progress reporting.
@@ -61,36 +115,92 @@ func ExtractUsername(target string) string {
 	return strings.TrimPrefix(target, "@")
 }
 
+// ExtractHashtag sanitizes a hashtag target, which could be a tag with or without '#' or a tag URL.
+// The result is lower-cased and has no leading '#'.
+func ExtractHashtag(target string) string {
+	target = strings.TrimSpace(target)
+	if u, err := url.Parse(target); err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.Contains(u.Host, "tiktok.com") {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) >= 2 && parts[0] == "tag" {
+			target = parts[1]
+		}
+	}
+	return strings.ToLower(strings.TrimPrefix(target, "#"))
+}
+
 // getQualitiesToDownload determines the asset types to download based on the configuration.
+// For a quality ladder such as "source>hd>sd", the rungs are returned best first.
 func (c *Client) getQualitiesToDownload() ([]tikwm.AssetType, error) {
-	switch strings.ToLower(c.cfg.Quality) {
-	case "source":
-		return []tikwm.AssetType{tikwm.AssetSource}, nil
-	case "hd":
-		return []tikwm.AssetType{tikwm.AssetHD}, nil
-	case "sd":
-		return []tikwm.AssetType{tikwm.AssetSD}, nil
-	case "all":
-		return []tikwm.AssetType{tikwm.AssetSource, tikwm.AssetHD, tikwm.AssetSD}, nil
-	default:
-		return nil, fmt.Errorf("invalid quality '%s' in config, must be 'source', 'hd', 'sd', or 'all'", c.cfg.Quality)
+	quality := strings.ToLower(strings.TrimSpace(c.cfg.Quality))
+	if quality == "all" {
+		return []tikwm.AssetType{tikwm.AssetSource, tikwm.AssetHD, tikwm.AssetSD, tikwm.AssetWatermarked}, nil
+	}
+	var qualities []tikwm.AssetType
+	for _, rung := range strings.Split(quality, ladderSeparator) {
+		var assetType tikwm.AssetType
+		switch strings.TrimSpace(rung) {
+		case "source":
+			assetType = tikwm.AssetSource
+		case "hd":
+			assetType = tikwm.AssetHD
+		case "sd":
+			assetType = tikwm.AssetSD
+		case "wm":
+			assetType = tikwm.AssetWatermarked
+		default:
+			return nil, fmt.Errorf("invalid quality '%s' in config, must be 'source', 'hd', 'sd', 'wm', 'all', or a ladder such as 'source>hd>sd'", c.cfg.Quality)
+		}
+		if slices.Contains(qualities, assetType) {
+			return nil, fmt.Errorf("invalid quality '%s' in config, '%s' is listed twice", c.cfg.Quality, assetType)
+		}
+		qualities = append(qualities, assetType)
 	}
+	return qualities, nil
 }
 
 // getAssetPath constructs the full file path for a given asset.
 func (c *Client) getAssetPath(post *tikwm.Post, assetType tikwm.AssetType) string {
-	dOpts := (&tikwm.DownloadOpt{}).Defaults()
 	var filename string
 
 	switch assetType {
 	case tikwm.AssetCoverMedium, tikwm.AssetCoverOrigin, tikwm.AssetCoverDynamic:
-		filename = fmt.Sprintf("%s_%s_%s_%s.jpg", post.Author.UniqueId, time.Unix(post.CreateTime, 0).Format(time.DateOnly), post.ID(), assetType)
+		filename = fmt.Sprintf("%s_%s.jpg", c.postBaseName(post), assetType)
 	default:
 		// For HD/SD/Source videos, the asset index 'i' is always 0.
-		filename = dOpts.FilenameFormat(post, 0, assetType)
+		filename = c.filenameFormat()(post, 0, assetType)
 	}
 
-	return path.Join(c.cfg.DownloadPath, post.Author.UniqueId, filename)
+	return path.Join(c.postDir(c.cfg.DownloadPath, post), filename)
+}
+
+// postDir returns the directory under base in which the files of a post are stored.
+func (c *Client) postDir(base string, post *tikwm.Post) string {
+	if c.flat {
+		return base
+	}
+	return path.Join(base, post.Author.UniqueId)
+}
+
+// prefixed applies the client's filename prefix, if any, to the filename of a post's file.
+func (c *Client) prefixed(post *tikwm.Post, filename string) string {
+	if c.filePrefix == nil {
+		return filename
+	}
+	return c.filePrefix(post) + filename
+}
+
+// postBaseName returns the name, without extension, of the title, cover and sidecar files of a post:
+// "<author>_<date>_<id>" with the client's filename prefix applied.
+func (c *Client) postBaseName(post *tikwm.Post) string {
+	return c.prefixed(post, fmt.Sprintf("%s_%s_%s", post.Author.UniqueId, time.Unix(post.CreateTime, 0).Format(time.DateOnly), post.ID()))
+}
+
+// filenameFormat returns the filename format for downloaded media, applying the client's filename prefix.
+func (c *Client) filenameFormat() func(post *tikwm.Post, i int, assetType tikwm.AssetType) string {
+	format := (&tikwm.DownloadOpt{}).Defaults().FilenameFormat
+	return func(post *tikwm.Post, i int, assetType tikwm.AssetType) string {
+		return c.prefixed(post, format(post, i, assetType))
+	}
 }
 
 // getCoverAssetType selects the correct cover asset type based on config.
@@ -150,7 +260,23 @@ func (c *Client) adoptLocalAsset(post *tikwm.Post, assetType tikwm.AssetType, lo
 	if post.IsAlbum() {
 		return fmt.Errorf("adoptLocalAsset should not be called for albums")
 	}
-	return c.db.AddOrUpdateAsset(assetID, post.Author.UniqueId, post.CreateTime, assetType, hash)
+	return c.recordAsset(post, assetID, assetType, hash)
+}
+
+// recordAsset records an asset of post, stored under assetID, in the database, along with the post's metadata.
+// Album photos are stored under their own IDs, while the metadata is always recorded for the post.
+func (c *Client) recordAsset(post *tikwm.Post, assetID string, assetType tikwm.AssetType, sha256 string) error {
+	if err := c.db.AddOrUpdateAsset(assetID, post.Author.UniqueId, post.CreateTime, assetType, sha256); err != nil {
+		return err
+	}
+	if c.metadata == nil {
+		return nil
+	}
+	// The asset is recorded either way, so a metadata failure is not an asset failure.
+	if err := c.metadata.SavePostMetadata(post); err != nil {
+		c.logger.Printf("Could not save metadata of post %s: %v", post.ID(), err)
+	}
+	return nil
 }
 
 // DownloadPost downloads a single post by its URL.
@@ -165,13 +291,22 @@ func (c *Client) DownloadPost(ctx context.Context, url string, force bool, logge
 		if err != nil {
 			return err
 		}
-		for _, assetType := range qualities {
-			if err := c.ensureVideoAsset(ctx, post, assetType, force, logger); err != nil {
-				logger.Printf("Could not process video for post %s (quality: %s): %v", post.ID(), assetType, err)
+		if c.isLadder() {
+			if err := c.ensureVideoLadder(ctx, post, qualities, force, logger); err != nil {
+				logger.Printf("Could not process video for post %s: %v", post.ID(), err)
 				if errors.Is(err, tikwm.ErrDiskSpace) {
 					return err // Propagate fatal error
 				}
 			}
+		} else {
+			for _, assetType := range qualities {
+				if err := c.ensureVideoAsset(ctx, post, assetType, force, logger); err != nil {
+					logger.Printf("Could not process video for post %s (quality: %s): %v", post.ID(), assetType, err)
+					if errors.Is(err, tikwm.ErrDiskSpace) {
+						return err // Propagate fatal error
+					}
+				}
+			}
 		}
 	} else if post.IsAlbum() {
 		if err := c.ensureAlbum(ctx, post, force, logger); err != nil {
@@ -198,6 +333,24 @@ func (c *Client) DownloadPost(ctx context.Context, url string, force bool, logge
 			}
 		}
 	}
+	if c.cfg.DownloadMusic {
+		if err := c.ensureMusic(ctx, post, force, logger, make(map[string]bool)); err != nil {
+			logger.Printf("Could not download music for post %s: %v", post.ID(), err)
+			if errors.Is(err, tikwm.ErrDiskSpace) {
+				return err // Propagate fatal error
+			}
+		}
+	}
+	if c.cfg.SaveComments {
+		if err := c.ensureComments(ctx, post, force, logger); err != nil {
+			logger.Printf("Could not save comments for post %s: %v", post.ID(), err)
+		}
+	}
+	if c.cfg.SavePostMetadata {
+		if err := c.ensurePostMetadata(post, force, logger); err != nil {
+			logger.Printf("Could not save metadata for post %s: %v", post.ID(), err)
+		}
+	}
 	return nil
 }
 
@@ -215,10 +368,9 @@ func (c *Client) DownloadProfile(ctx context.Context, username string, force boo
 		return fmt.Errorf("invalid since date format: %w", err)
 	}
 
-	processedAvatars := make(map[string]bool)
-
 	feedOpt := &tikwm.FeedOpt{
-		While: tikwm.WhileAfter(since),
+		While:         tikwm.WhileAfter(since),
+		HeadTolerance: max(0, c.cfg.PinnedTolerance),
 		OnError: func(err error) {
 			logger.Printf("Error during feed fetch for '%s': %v", username, err)
 		},
@@ -226,14 +378,162 @@ func (c *Client) DownloadProfile(ctx context.Context, username string, force boo
 			progressCb(count, 0, fmt.Sprintf("%d posts found", count))
 		},
 	}
-	postChan, expectedCount, err := c.getUserFeed(ctx, username, feedOpt)
+	feed := c.getUserFeed(ctx, username, feedOpt)
+	return c.processFeed(ctx, username, feed, qualitiesNeeded, force, logger, progressCb, nil)
+}
+
+// DownloadHashtag downloads the posts of a hashtag (challenge) feed.
+// Files are stored under a "#<tag>" directory inside the download path, grouped by author,
+// and every post found is associated with the hashtag in the database.
+// The hashtag feed is not ordered by date, so the since date filters posts instead of ending the feed early.
+func (c *Client) DownloadHashtag(ctx context.Context, tag string, force bool, logger *log.Logger, progressCb ProgressCallback) error {
+	if progressCb == nil {
+		progressCb = noOpProgress
+	}
+	tag = ExtractHashtag(tag)
+	if tag == "" {
+		return fmt.Errorf("hashtag cannot be empty")
+	}
+	qualitiesNeeded, err := c.getQualitiesToDownload()
 	if err != nil {
 		return err
 	}
-	if expectedCount == 0 {
-		logger.Printf("No new posts found for user %s since %s.", username, since.Format(time.DateOnly))
-		progressCb(0, 0, "No new posts found.")
-		return nil
+	since, err := time.Parse(time.DateTime, c.cfg.Since)
+	if err != nil {
+		return fmt.Errorf("invalid since date format: %w", err)
+	}
+
+	progressCb(0, 0, "Looking up hashtag...")
+	info, err := c.backend.GetChallengeInfo(ctx, tag)
+	if err != nil {
+		return fmt.Errorf("failed to look up hashtag #%s: %w", tag, err)
+	}
+	if info.Id == "" {
+		return fmt.Errorf("API returned an empty challenge ID for hashtag #%s", tag)
+	}
+	logger.Printf("Hashtag #%s has challenge ID %s.", tag, info.Id)
+
+	feedOpt := &tikwm.FeedOpt{
+		Filter: tikwm.WhileAfter(since),
+		OnError: func(err error) {
+			logger.Printf("Error during feed fetch for '#%s': %v", tag, err)
+		},
+		OnFeedProgress: func(count int) {
+			progressCb(count, 0, fmt.Sprintf("%d posts found", count))
+		},
+	}
+	fetch := func(ctx context.Context, cursor string) (*tikwm.UserFeed, error) {
+		return c.backend.GetChallengeFeed(ctx, info.Id, tikwm.MaxUserFeedCount, cursor)
+	}
+	feed := c.getFeed(ctx, "#"+tag, fetch, feedOpt)
+
+	recordSource := func(post *tikwm.Post) {
+		c.recordPostSource(post, storage.SourceHashtag, tag, logger)
+	}
+	return c.inSubdir("#"+tag).processFeed(ctx, "#"+tag, feed, qualitiesNeeded, force, logger, progressCb, recordSource)
+}
+
+// Search pages through the search feed for query and returns the posts accepted by opt.
+// Search results are not ordered by date, so opt.While should only be used to limit the number of results
+// and date ranges should be applied with opt.Filter.
+func (c *Client) Search(ctx context.Context, query string, opt *tikwm.FeedOpt) ([]tikwm.Post, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+	return c.collectFeed(ctx, c.searchPager(query), opt)
+}
+
+// searchPager returns a feedPager for the search results of query.
+func (c *Client) searchPager(query string) feedPager {
+	return func(ctx context.Context, cursor string) (*tikwm.UserFeed, error) {
+		return c.backend.SearchPosts(ctx, query, tikwm.MaxUserFeedCount, cursor)
+	}
+}
+
+// DownloadSearch downloads the posts found by a keyword search, applying the since date as a filter.
+// Posts are stored in their authors' directories like with DownloadProfile, and the query that found
+// each post is recorded in the database. Search results are never cached.
+func (c *Client) DownloadSearch(ctx context.Context, query string, force bool, logger *log.Logger, progressCb ProgressCallback) error {
+	if progressCb == nil {
+		progressCb = noOpProgress
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return fmt.Errorf("search query cannot be empty")
+	}
+	qualitiesNeeded, err := c.getQualitiesToDownload()
+	if err != nil {
+		return err
+	}
+	since, err := time.Parse(time.DateTime, c.cfg.Since)
+	if err != nil {
+		return fmt.Errorf("invalid since date format: %w", err)
+	}
+
+	feedOpt := &tikwm.FeedOpt{
+		Filter: tikwm.WhileAfter(since),
+		OnError: func(err error) {
+			logger.Printf("Error during search for '%s': %v", query, err)
+		},
+		OnFeedProgress: func(count int) {
+			progressCb(count, 0, fmt.Sprintf("%d posts found", count))
+		},
+	}
+	feed := c.getFeed(ctx, "", c.searchPager(query), feedOpt)
+
+	recordSource := func(post *tikwm.Post) {
+		c.recordPostSource(post, storage.SourceSearch, query, logger)
+	}
+	return c.processFeed(ctx, "search '"+query+"'", feed, qualitiesNeeded, force, logger, progressCb, recordSource)
+}
+
+// recordPostSource records that post was found through a feed of sourceType other than its author's profile,
+// if the database records post sources. Failures are only logged.
+func (c *Client) recordPostSource(post *tikwm.Post, sourceType, source string, logger *log.Logger) {
+	if c.postSources == nil {
+		return
+	}
+	if err := c.postSources.AddPostSource(post.ID(), sourceType, source); err != nil {
+		logger.Printf("Could not record %s '%s' for post %s: %v", sourceType, source, post.ID(), err)
+	}
+}
+
+// inSubdir returns a copy of the client that stores posts in a subdirectory of the download path.
+// Assets shared between feeds, such as music and avatars, keep using the top-level download path.
+func (c *Client) inSubdir(dir string) *Client {
+	cfg := *c.cfg
+	cfg.DownloadPath = path.Join(c.cfg.DownloadPath, dir)
+	clone := *c
+	clone.cfg = &cfg
+	clone.sharedPath = c.sharedDownloadPath()
+	return &clone
+}
+
+// sharedDownloadPath returns the top-level download path, even for clients created by inSubdir.
+func (c *Client) sharedDownloadPath() string {
+	if c.sharedPath != "" {
+		return c.sharedPath
+	}
+	return c.cfg.DownloadPath
+}
+
+// processFeed downloads every post received from feed, along with its cover, avatar and music if enabled.
+// If onPost is not nil, it is called for each post before it is processed.
+// Posts received before a pagination error are processed before the error is returned.
+// For checkpointed feeds, a checkpoint is saved after each post and cleared once the whole feed has been processed.
+func (c *Client) processFeed(ctx context.Context, label string, feed *postFeed, qualitiesNeeded []tikwm.AssetType, force bool, logger *log.Logger, progressCb ProgressCallback, onPost func(post *tikwm.Post)) error {
+	defer feed.stop()
+	processedAvatars := make(map[string]bool)
+	processedMusic := make(map[string]bool)
+
+	items := feed.items
+	prefetchCtx := ctx
+	if c.cfg.SourcePrefetch > 0 && slices.Contains(qualitiesNeeded, tikwm.AssetSource) {
+		var cancel context.CancelFunc
+		prefetchCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		items = c.prefetchSources(prefetchCtx, feed.items, force)
 	}
 
 	i := 0
@@ -241,22 +541,35 @@ loop:
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Printf("Profile download for %s cancelled.", username)
+			logger.Printf("Feed download for %s cancelled.", label)
 			break loop
-		case postFromFeed, ok := <-postChan:
+		case item, ok := <-items:
 			if !ok {
 				break loop // Channel closed, normal exit
 			}
+			postFromFeed := item.post
 			i++
 			postID := postFromFeed.ID()
-			progressCb(i, expectedCount, fmt.Sprintf("Checking %s", postID))
-			logger.Printf("--- Checking post %s (%d/%d) ---", postID, i, expectedCount)
+			// The total is only known once pagination has finished.
+			expectedCount := int(feed.total.Load())
+			if expectedCount > 0 {
+				progressCb(i, expectedCount, fmt.Sprintf("Checking %s", postID))
+				logger.Printf("--- Checking post %s (%d/%d) ---", postID, i, expectedCount)
+			} else {
+				found := feed.found.Load()
+				progressCb(i, 0, fmt.Sprintf("Checking %s (%d of %d posts found so far)", postID, i, found))
+				logger.Printf("--- Checking post %s (%d/%d found so far) ---", postID, i, found)
+			}
+			if onPost != nil {
+				onPost(&postFromFeed)
+			}
 
 			var procErr error
 			if postFromFeed.IsAlbum() {
 				procErr = c.processAlbumInFeed(ctx, &postFromFeed, force, logger, progressCb, i, expectedCount)
 			} else { // Is a video
 				procErr = c.processVideoInFeed(ctx, &postFromFeed, qualitiesNeeded, force, logger)
+				c.sources.release(prefetchCtx, postID)
 			}
 			if procErr != nil {
 				if errors.Is(procErr, tikwm.ErrDiskSpace) || errors.Is(procErr, context.Canceled) {
@@ -284,12 +597,54 @@ loop:
 					logger.Printf("Could not download avatar for %s: %v", postFromFeed.Author.UniqueId, err)
 				}
 			}
+			// Process music once per music ID per run, linking every post that uses it
+			if c.cfg.DownloadMusic {
+				if err := c.ensureMusic(ctx, &postFromFeed, force, logger, processedMusic); err != nil {
+					if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
+						return err // Abort profile download on fatal error
+					}
+					logger.Printf("Could not download music for post %s: %v", postID, err)
+				}
+			}
+			// Save or refresh comments; this never re-downloads media
+			if c.cfg.SaveComments {
+				if err := c.ensureComments(ctx, &postFromFeed, force, logger); err != nil {
+					if errors.Is(err, context.Canceled) {
+						return err
+					}
+					logger.Printf("Could not save comments for post %s: %v", postID, err)
+				}
+			}
+			// Save or refresh the metadata sidecar once the post's assets are recorded
+			if c.cfg.SavePostMetadata {
+				if err := c.ensurePostMetadata(&postFromFeed, force, logger); err != nil {
+					logger.Printf("Could not save metadata for post %s: %v", postID, err)
+				}
+			}
+			// A post interrupted by cancellation is processed again when the crawl is resumed
+			if ctx.Err() == nil {
+				c.saveFeedCheckpoint(feed, item)
+			}
 		}
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
-	progressCb(expectedCount, expectedCount, "Profile processing complete.")
+	if feed.err != nil {
+		return feed.err
+	}
+	if feed.key != "" && c.checkpoints != nil {
+		// The crawl is complete, so the next one starts from the beginning.
+		if err := c.checkpoints.DeleteFeedCheckpoint(feed.key); err != nil {
+			logger.Printf("Could not clear checkpoint for feed %s: %v", feed.key, err)
+		}
+	}
+	if i == 0 {
+		logger.Printf("No new posts found for %s.", label)
+		progressCb(0, 0, "No new posts found.")
+		return nil
+	}
+	progressCb(i, i, "Feed processing complete.")
 	return nil
 }
 
@@ -311,7 +666,8 @@ func (c *Client) ensureAvatar(ctx context.Context, post *tikwm.Post, force bool,
 
 	logger.Printf("Processing avatar for %s...", authorID)
 
-	creatorDir := path.Join(c.cfg.DownloadPath, authorID)
+	// Avatars belong to the author rather than to a feed, so they always live in the top-level author directory.
+	creatorDir := path.Join(c.sharedDownloadPath(), authorID)
 	// #nosec G301
 	if err := os.MkdirAll(creatorDir, 0755); err != nil {
 		logger.Printf("Could not create directory for avatar for %s: %v", authorID, err)
@@ -357,14 +713,90 @@ func (c *Client) ensureAvatar(ctx context.Context, post *tikwm.Post, force bool,
 	return nil
 }
 
+// getMusicPath constructs the full file path for a music asset.
+// Music is shared between posts and creators, so it lives in its own directory keyed by music ID.
+func (c *Client) getMusicPath(musicID string, assetType tikwm.AssetType) string {
+	ext := "mp3"
+	if assetType == tikwm.AssetMusicCover {
+		ext = "jpg"
+	}
+	return path.Join(c.sharedDownloadPath(), musicDirName, fmt.Sprintf("%s_%s.%s", musicID, assetType, ext))
+}
+
+// ensureMusic handles downloading a post's music track and its cover if they are new.
+// Each music ID is stored only once, but every post using it is linked to it in the database.
+func (c *Client) ensureMusic(ctx context.Context, post *tikwm.Post, force bool, logger *log.Logger, processed map[string]bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.music == nil {
+		return nil // Music is only downloaded once per track, which takes the database.
+	}
+	music := &post.MusicInfo
+	if music.Id == "" {
+		logger.Printf("No music info found for post %s", post.ID())
+		return nil
+	}
+	if err := c.music.LinkPostMusic(post.ID(), music.Id); err != nil {
+		return err
+	}
+	if _, ok := processed[music.Id]; ok {
+		return nil // Already handled this music in this session
+	}
+	processed[music.Id] = true
+
+	playURL := music.Play
+	if playURL == "" {
+		playURL = post.Music
+	}
+	assets := []struct {
+		assetType tikwm.AssetType
+		url       string
+	}{
+		{tikwm.AssetMusic, playURL},
+		{tikwm.AssetMusicCover, music.Cover},
+	}
+	for _, asset := range assets {
+		if asset.url == "" {
+			logger.Printf("No URL found for %s of music %s", asset.assetType, music.Id)
+			continue
+		}
+		if !force {
+			exists, err := c.music.MusicExists(music.Id, asset.assetType)
+			if err != nil {
+				return fmt.Errorf("db check failed for music %s (type: %s): %w", music.Id, asset.assetType, err)
+			}
+			if exists {
+				continue
+			}
+		}
+
+		logger.Printf("Processing %s for music %s (%q by %s)...", asset.assetType, music.Id, music.Title, music.Author)
+		fullPath := c.getMusicPath(music.Id, asset.assetType)
+		musicDir := filepath.Dir(fullPath)
+		// #nosec G301
+		if err := os.MkdirAll(musicDir, 0755); err != nil {
+			return fmt.Errorf("failed to create music directory %s: %w", musicDir, err)
+		}
+		sha, err := tikwm.DownloadAndHash(asset.url, fullPath)
+		if err != nil {
+			return err
+		}
+		if err := c.music.AddOrUpdateMusic(music, asset.assetType, sha); err != nil {
+			return err
+		}
+		logger.Printf("Successfully downloaded %s for music %s to %s", asset.assetType, music.Id, fullPath)
+	}
+	return nil
+}
+
 // savePostTitle saves the post's title to a single, quality-agnostic text file.
 func (c *Client) savePostTitle(post *tikwm.Post, logger *log.Logger) error {
 	if !c.cfg.SavePostTitle || post.Title == "" {
 		return nil
 	}
 
-	baseFilename := fmt.Sprintf("%s_%s_%s", post.Author.UniqueId, time.Unix(post.CreateTime, 0).Format(time.DateOnly), post.ID())
-	txtPath := filepath.Join(c.cfg.DownloadPath, post.Author.UniqueId, baseFilename+".txt")
+	txtPath := filepath.Join(c.postDir(c.cfg.DownloadPath, post), c.postBaseName(post)+".txt")
 
 	// Check if the file already exists to avoid redundant writes.
 	if _, err := os.Stat(txtPath); err == nil {
@@ -376,10 +808,161 @@ func (c *Client) savePostTitle(post *tikwm.Post, logger *log.Logger) error {
 	return os.WriteFile(txtPath, []byte(post.Title), 0644)
 }
 
+// commentArchive is the content of a post's comments sidecar file.
+type commentArchive struct {
+	PostID       string          `json:"post_id"`
+	CommentCount int             `json:"comment_count"` // Comment count reported for the post when the archive was last refreshed.
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Comments     []tikwm.Comment `json:"comments"`
+}
+
+// getCommentsPath returns the path of the comments sidecar file for a post.
+func (c *Client) getCommentsPath(post *tikwm.Post) string {
+	return filepath.Join(c.postDir(c.cfg.DownloadPath, post), c.postBaseName(post)+"_comments.json")
+}
+
+// ensureComments saves a post's comments, including reply threads, to a JSON sidecar next to its media.
+// An existing sidecar is only refreshed when the post's comment count has changed, and refreshed
+// comments are merged into it so that comments deleted since the last run are kept.
+func (c *Client) ensureComments(ctx context.Context, post *tikwm.Post, force bool, logger *log.Logger) error {
+	commentsPath := c.getCommentsPath(post)
+	var archive commentArchive
+	data, err := os.ReadFile(commentsPath) // #nosec G304
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &archive); err != nil {
+			logger.Printf("Could not parse comments file %s, rebuilding it: %v", commentsPath, err)
+			archive = commentArchive{}
+		} else if !force && archive.CommentCount == post.CommentCount {
+			return nil // Nothing changed since the last run.
+		}
+	case os.IsNotExist(err):
+		if post.CommentCount == 0 {
+			return nil // Nothing to save.
+		}
+	default:
+		return fmt.Errorf("failed to read comments file %s: %w", commentsPath, err)
+	}
+
+	logger.Printf("Fetching comments for post %s (%d reported)...", post.ID(), post.CommentCount)
+	comments, err := c.fetchCommentPages(ctx, func(ctx context.Context, cursor string) (*tikwm.CommentPage, error) {
+		return c.backend.GetComments(ctx, post.ID(), tikwm.MaxCommentCount, cursor)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch comments: %w", err)
+	}
+	for i := range comments {
+		if comments[i].ReplyTotal == 0 {
+			continue
+		}
+		commentID := comments[i].Id
+		replies, err := c.fetchCommentPages(ctx, func(ctx context.Context, cursor string) (*tikwm.CommentPage, error) {
+			return c.backend.GetCommentReplies(ctx, commentID, tikwm.MaxCommentCount, cursor)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch replies to comment %s: %w", commentID, err)
+		}
+		comments[i].Replies = replies
+	}
+
+	archive.PostID = post.ID()
+	archive.CommentCount = post.CommentCount
+	archive.UpdatedAt = time.Now().UTC()
+	archive.Comments = mergeComments(archive.Comments, comments)
+
+	data, err = json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize comments: %w", err)
+	}
+	// #nosec G301
+	if err := os.MkdirAll(filepath.Dir(commentsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create creator directory: %w", err)
+	}
+	if err := writeFileAtomic(commentsPath, data); err != nil {
+		return fmt.Errorf("failed to write comments file: %w", err)
+	}
+	logger.Printf("Saved %d comments for post %s to %s", len(archive.Comments), post.ID(), commentsPath)
+	return nil
+}
+
+// writeFileAtomic writes data to the file at path through a temporary file that is then moved into place,
+// so that an interrupted run never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tempPath := path + ".tmp"
+	// #nosec G306
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// commentPager fetches one page of comments starting at cursor.
+type commentPager func(ctx context.Context, cursor string) (*tikwm.CommentPage, error)
+
+// fetchCommentPages pages through comments with fetch, retrying rate-limited pages like the feed fetcher does.
+func (c *Client) fetchCommentPages(ctx context.Context, fetch commentPager) ([]tikwm.Comment, error) {
+	var comments []tikwm.Comment
+	cursor := "0"
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := fetch(ctx, cursor)
+		if err != nil {
+			if errors.Is(err, tikwm.ErrDailyQuota) {
+				rotated := network.RotateOnDailyQuota()
+				c.logger.Printf("Daily rate limit hit while fetching comments. Rotating %s and retrying from cursor %s.", rotated, cursor)
+				continue
+			}
+			if errors.Is(err, tikwm.ErrRateLimited) && c.cfg.RetryOn429 {
+				if err := rateLimitBackoff(ctx, 2*time.Second); err != nil {
+					return nil, err
+				}
+				continue // Retry the same request
+			}
+			return nil, err
+		}
+		comments = append(comments, page.Comments...)
+		next := page.Cursor.String()
+		if !page.HasMore || next == "" || next == cursor {
+			return comments, nil
+		}
+		cursor = next
+	}
+}
+
+// mergeComments merges freshly fetched comments into previously archived ones.
+// Fresh comments replace archived comments with the same ID, and archived comments
+// that are no longer returned by the API are kept at the end.
+func mergeComments(archived, fresh []tikwm.Comment) []tikwm.Comment {
+	old := make(map[string]tikwm.Comment, len(archived))
+	for _, comment := range archived {
+		old[comment.Id] = comment
+	}
+	merged := make([]tikwm.Comment, 0, len(fresh)+len(archived))
+	seen := make(map[string]bool, len(fresh))
+	for _, comment := range fresh {
+		if prev, ok := old[comment.Id]; ok {
+			comment.Replies = mergeComments(prev.Replies, comment.Replies)
+		}
+		seen[comment.Id] = true
+		merged = append(merged, comment)
+	}
+	for _, comment := range archived {
+		if !seen[comment.Id] {
+			merged = append(merged, comment)
+		}
+	}
+	return merged
+}
+
 // processVideoInFeed handles video-specific processing within the feed.
 func (c *Client) processVideoInFeed(ctx context.Context, postFromFeed *tikwm.Post, qualitiesNeeded []tikwm.AssetType, force bool, logger *log.Logger) error {
 	postID := postFromFeed.ID()
-	validator := tikwm.ValidateWithFfmpeg(c.cfg.FfmpegPath)
 
 	if force {
 		logger.Printf("Force enabled for %s. Fetching full details to download all qualities.", postID)
@@ -388,6 +971,9 @@ func (c *Client) processVideoInFeed(ctx context.Context, postFromFeed *tikwm.Pos
 			logger.Printf("Failed to get full post details for %s: %v", postID, err)
 			return err
 		}
+		if c.isLadder() {
+			return c.ensureVideoLadder(ctx, fullPost, qualitiesNeeded, true, logger)
+		}
 		for _, quality := range qualitiesNeeded {
 			if err := c.ensureVideoAsset(ctx, fullPost, quality, true, logger); err != nil {
 				logger.Printf("Error during forced download for %s (quality: %s): %v", postID, quality, err)
@@ -399,6 +985,18 @@ func (c *Client) processVideoInFeed(ctx context.Context, postFromFeed *tikwm.Pos
 		return nil
 	}
 
+	if c.isLadder() {
+		held, err := c.heldRung(postID, qualitiesNeeded)
+		if err != nil {
+			return err
+		}
+		if held != "" {
+			return nil
+		}
+		return c.downloadLadder(ctx, postFromFeed, qualitiesNeeded, "", logger, func(quality tikwm.AssetType) error {
+			return c.ensureVideoInFeed(ctx, postFromFeed, quality, logger)
+		})
+	}
 	for _, quality := range qualitiesNeeded {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -406,69 +1004,80 @@ func (c *Client) processVideoInFeed(ctx context.Context, postFromFeed *tikwm.Pos
 		if exists, _ := c.db.AssetExists(postID, quality); exists {
 			continue
 		}
-
-		exists, size, err := c.checkLocalAsset(postFromFeed, quality, logger)
-		if err != nil {
-			logger.Printf("Error checking local asset for %s (quality: %s): %v. Will attempt download.", postID, quality, err)
-			if err := c.ensureVideoAsset(ctx, postFromFeed, quality, true, logger); err != nil {
-				logger.Printf("Error downloading video for %s: %v", postID, err)
-				if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
-					return err
-				}
+		if err := c.ensureVideoInFeed(ctx, postFromFeed, quality, logger); err != nil {
+			if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
+				return err
 			}
-			continue
 		}
+	}
+	return nil
+}
 
-		if !exists {
-			logger.Printf("Asset for %s (quality: %s) not found. Downloading.", postID, quality)
-			if err := c.ensureVideoAsset(ctx, postFromFeed, quality, true, logger); err != nil {
-				logger.Printf("Error downloading video for %s: %v", postID, err)
-				if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
-					return err
-				}
-			}
-			continue
+// ensureVideoInFeed makes sure that a video from a feed, which is not in the database in the given quality,
+// is on disk in that quality. A local file is adopted if it passes validation, and downloaded again otherwise.
+// Errors are logged before they are returned.
+func (c *Client) ensureVideoInFeed(ctx context.Context, postFromFeed *tikwm.Post, quality tikwm.AssetType, logger *log.Logger) error {
+	postID := postFromFeed.ID()
+	exists, size, err := c.checkLocalAsset(postFromFeed, quality, logger)
+	if err != nil {
+		logger.Printf("Error checking local asset for %s (quality: %s): %v. Will attempt download.", postID, quality, err)
+		if err := c.ensureVideoAsset(ctx, postFromFeed, quality, true, logger); err != nil {
+			logger.Printf("Error downloading video for %s: %v", postID, err)
+			return err
 		}
+		return nil
+	}
 
-		// File exists locally, proceed with validation.
-		shouldAdopt := false
-		if quality == tikwm.AssetSD {
-			// For SD, we can validate size first.
-			if postFromFeed.Size > 0 && size == int64(postFromFeed.Size) {
-				logger.Printf("Local SD file for post %s has correct size. Proceeding to ffmpeg validation.", postID)
-				shouldAdopt = true
-			} else {
-				logger.Printf("Local SD file for post %s has incorrect size (expected: %d, actual: %d). Re-downloading.", postID, postFromFeed.Size, size)
-			}
-		} else { // For HD and Source, we must rely on ffmpeg validation alone.
-			logger.Printf("Local %s file found for %s. Proceeding to ffmpeg validation.", quality, postID)
-			shouldAdopt = true
+	if !exists {
+		logger.Printf("Asset for %s (quality: %s) not found. Downloading.", postID, quality)
+		if err := c.ensureVideoAsset(ctx, postFromFeed, quality, true, logger); err != nil {
+			logger.Printf("Error downloading video for %s: %v", postID, err)
+			return err
 		}
+		return nil
+	}
 
-		if shouldAdopt && c.cfg.FfmpegPath != "" {
-			valid, validationErr := validator(c.getAssetPath(postFromFeed, quality))
-			if validationErr != nil {
-				logger.Printf("Ffmpeg validation failed for %s (quality: %s): %v. Re-downloading.", postID, quality, validationErr)
-				shouldAdopt = false
-			} else if valid {
-				logger.Printf("Ffmpeg validation passed for %s (quality: %s). Adopting.", postID, quality)
-			}
+	// File exists locally, proceed with validation.
+	shouldAdopt := false
+	if quality == tikwm.AssetSD || quality == tikwm.AssetWatermarked {
+		// For SD and watermarked videos, the feed gives the size, so we can validate size first.
+		expected := postFromFeed.Size
+		if quality == tikwm.AssetWatermarked {
+			expected = postFromFeed.WmSize
 		}
-
-		if shouldAdopt {
-			if err := c.adoptLocalAsset(postFromFeed, quality, logger); err != nil {
-				logger.Printf("Failed to adopt existing file for %s (quality: %s): %v", postID, quality, err)
-			}
+		label := strings.ToUpper(string(quality))
+		if expected > 0 && size == int64(expected) {
+			logger.Printf("Local %s file for post %s has correct size. Proceeding to ffmpeg validation.", label, postID)
+			shouldAdopt = true
 		} else {
-			// If we decided not to adopt for any reason (bad size, failed validation), re-download.
-			if err := c.ensureVideoAsset(ctx, postFromFeed, quality, true, logger); err != nil {
-				logger.Printf("Error re-downloading video for %s: %v", postID, err)
-				if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
-					return err
-				}
-			}
+			logger.Printf("Local %s file for post %s has incorrect size (expected: %d, actual: %d). Re-downloading.", label, postID, expected, size)
+		}
+	} else { // For HD and Source, we must rely on ffmpeg validation alone.
+		logger.Printf("Local %s file found for %s. Proceeding to ffmpeg validation.", quality, postID)
+		shouldAdopt = true
+	}
+
+	if shouldAdopt && c.cfg.FfmpegPath != "" {
+		valid, validationErr := tikwm.ValidateWithFfmpeg(c.cfg.FfmpegPath)(c.getAssetPath(postFromFeed, quality))
+		if validationErr != nil {
+			logger.Printf("Ffmpeg validation failed for %s (quality: %s): %v. Re-downloading.", postID, quality, validationErr)
+			shouldAdopt = false
+		} else if valid {
+			logger.Printf("Ffmpeg validation passed for %s (quality: %s). Adopting.", postID, quality)
 		}
 	}
+
+	if shouldAdopt {
+		if err := c.adoptLocalAsset(postFromFeed, quality, logger); err != nil {
+			logger.Printf("Failed to adopt existing file for %s (quality: %s): %v", postID, quality, err)
+		}
+		return nil
+	}
+	// If we decided not to adopt for any reason (bad size, failed validation), re-download.
+	if err := c.ensureVideoAsset(ctx, postFromFeed, quality, true, logger); err != nil {
+		logger.Printf("Error re-downloading video for %s: %v", postID, err)
+		return err
+	}
 	return nil
 }
 
@@ -486,7 +1095,7 @@ func (c *Client) ensureVideoAsset(ctx context.Context, post *tikwm.Post, assetTy
 	}
 	logger.Printf("Processing video asset for post %s (quality: %s)...", post.ID(), assetType)
 
-	_, sha, err := c.downloadVideo(ctx, post, assetType, tikwm.DownloadOpt{Directory: c.cfg.DownloadPath, FfmpegPath: c.cfg.FfmpegPath})
+	_, sha, err := c.downloadVideo(ctx, post, assetType, tikwm.DownloadOpt{Directory: c.cfg.DownloadPath, FfmpegPath: c.cfg.FfmpegPath, FilenameFormat: c.filenameFormat()})
 	if err != nil {
 		return err
 	}
@@ -494,7 +1103,7 @@ func (c *Client) ensureVideoAsset(ctx context.Context, post *tikwm.Post, assetTy
 		return fmt.Errorf("asset processing succeeded but returned empty SHA256 hash for post %s", post.ID())
 	}
 
-	if err := c.db.AddOrUpdateAsset(post.ID(), post.Author.UniqueId, post.CreateTime, assetType, sha); err != nil {
+	if err := c.recordAsset(post, post.ID(), assetType, sha); err != nil {
 		return err
 	}
 	// Save title after successful video download and DB update.
@@ -530,7 +1139,7 @@ func (c *Client) ensureCoverAsset(ctx context.Context, post *tikwm.Post, force b
 	if err != nil {
 		return err
 	}
-	return c.db.AddOrUpdateAsset(post.ID(), post.Author.UniqueId, post.CreateTime, assetType, sha)
+	return c.recordAsset(post, post.ID(), assetType, sha)
 }
 
 func (c *Client) processCoverInFeed(ctx context.Context, post *tikwm.Post, force bool, logger *log.Logger) error {
@@ -622,7 +1231,7 @@ func (c *Client) ensureAlbum(ctx context.Context, post *tikwm.Post, force bool,
 
 		logger.Printf("Processing photo %d/%d for post %s.", photoNum, len(post.Images), post.ID())
 
-		_, sha, err := c.downloadAlbumPhoto(ctx, post, photoIndex, tikwm.DownloadOpt{Directory: c.cfg.DownloadPath})
+		_, sha, err := c.downloadAlbumPhoto(ctx, post, photoIndex, tikwm.DownloadOpt{Directory: c.cfg.DownloadPath, FilenameFormat: c.filenameFormat()})
 		if err != nil {
 			logger.Printf("Failed to download photo %s: %v", albumPhotoID, err)
 			if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
@@ -635,7 +1244,7 @@ func (c *Client) ensureAlbum(ctx context.Context, post *tikwm.Post, force bool,
 			continue
 		}
 
-		err = c.db.AddOrUpdateAsset(albumPhotoID, post.Author.UniqueId, post.CreateTime, tikwm.AssetAlbumPhoto, sha)
+		err = c.recordAsset(post, albumPhotoID, tikwm.AssetAlbumPhoto, sha)
 		if err != nil {
 			logger.Printf("Failed to add photo %s to database: %v", albumPhotoID, err)
 		} else {
@@ -701,6 +1310,9 @@ func (c *Client) FixProfile(ctx context.Context, username string, logger *log.Lo
 	if err != nil {
 		return err
 	}
+	if c.isLadder() {
+		return c.fixLadder(ctx, username, qualities, logger, progressCb)
+	}
 	for _, assetType := range qualities {
 		progressCb(0, 0, fmt.Sprintf("Checking database for missing %s videos...", assetType))
 		missingPosts, err := c.db.GetMissingPostsByAuthor(username, assetType)
@@ -753,32 +1365,35 @@ func (c *Client) getPostWithRetry(ctx context.Context, post *tikwm.Post, progres
 				id = post.Id
 			}
 			progressCb(current, total, "Fetching post details for "+id)
-			hdPost, err := tikwm.GetPost(id, true)
+			hdPost, err := c.backend.GetPost(ctx, id, true)
 
 			if err != nil {
-				if tikwm.IsDailyRateLimitError(err) {
-					network.MarkCurrentAddressAsExhausted()
-					c.logger.Printf("Daily rate limit hit. Marking current IP as exhausted and retrying with next available IP.")
-					progressCb(current, total, "Daily rate limit hit. Rotating IP...")
-					// The next iteration will automatically use the next IP.
+				if errors.Is(err, tikwm.ErrDailyQuota) {
+					rotated := network.RotateOnDailyQuota()
+					c.logger.Printf("Daily rate limit hit. Marking current %s as exhausted and retrying with the next available one.", rotated)
+					progressCb(current, total, fmt.Sprintf("Daily rate limit hit. Rotating %s...", rotated))
+					// The next iteration will automatically use the next IP or API key.
 					continue
 				}
 
-				if strings.Contains(err.Error(), "(-1)") || strings.Contains(err.Error(), "(429)") {
+				if errors.Is(err, tikwm.ErrRateLimited) {
 					if !c.cfg.RetryOn429 {
-						return nil, fmt.Errorf("rate limited fetching post %s, aborting. Enable --retry-on-429 to retry", id)
+						return nil, fmt.Errorf("%w fetching post %s, aborting. Enable --retry-on-429 to retry", tikwm.ErrRateLimited, id)
 					}
 					wait := time.Second * time.Duration(2<<i) // Exponential backoff: 2s, 4s, 8s...
-					progressCb(current, total, fmt.Sprintf("Rate limited. Retrying in %s...", wait))
-					select {
-					case <-time.After(wait):
-						continue
-					case <-ctx.Done():
-						return nil, ctx.Err()
+					if tikwm.AdaptiveRateLimit {
+						progressCb(current, total, fmt.Sprintf("Rate limited. Retrying at 1 request every %s...", tikwm.CurrentRequestDelay()))
+					} else {
+						progressCb(current, total, fmt.Sprintf("Rate limited. Retrying in %s...", wait))
 					}
+					if err := rateLimitBackoff(ctx, wait); err != nil {
+						return nil, err
+					}
+					continue
 				}
 				return nil, err
 			}
+			c.recordPostStats([]tikwm.Post{*hdPost})
 			return hdPost, nil
 		}
 	}
@@ -790,7 +1405,7 @@ func (c *Client) getPostWithRetry(ctx context.Context, post *tikwm.Post, progres
 // downloadVideo downloads a specific quality of a video post.
 func (c *Client) downloadVideo(ctx context.Context, post *tikwm.Post, assetType tikwm.AssetType, opts ...tikwm.DownloadOpt) (file string, sha256 string, err error) {
 	switch assetType {
-	case tikwm.AssetHD, tikwm.AssetSD, tikwm.AssetSource:
+	case tikwm.AssetHD, tikwm.AssetSD, tikwm.AssetSource, tikwm.AssetWatermarked:
 		// Valid types
 	default:
 		return "", "", fmt.Errorf("unsupported asset type for video download: %s", assetType)
@@ -802,7 +1417,7 @@ func (c *Client) downloadVideo(ctx context.Context, post *tikwm.Post, assetType
 	}
 	opt = opt.Defaults()
 
-	creatorDir := path.Join(opt.Directory, post.Author.UniqueId)
+	creatorDir := c.postDir(opt.Directory, post)
 	// #nosec G301
 	if err := os.MkdirAll(creatorDir, 0755); err != nil {
 		return "", "", fmt.Errorf("failed to create creator directory %s: %w", creatorDir, err)
@@ -835,7 +1450,7 @@ func (c *Client) downloadAlbumPhoto(ctx context.Context, post *tikwm.Post, index
 	}
 	opt = opt.Defaults()
 
-	creatorDir := path.Join(opt.Directory, post.Author.UniqueId)
+	creatorDir := c.postDir(opt.Directory, post)
 	// #nosec G301
 	if err := os.MkdirAll(creatorDir, 0755); err != nil {
 		return "", "", fmt.Errorf("failed to create creator directory %s: %w", creatorDir, err)
@@ -879,8 +1494,12 @@ func (c *Client) downloadRetrying(ctx context.Context, post *tikwm.Post, assetTy
 			return ctx.Err()
 		}
 
-		if assetType == tikwm.AssetHD || assetType == tikwm.AssetSD {
+		if assetType == tikwm.AssetHD || assetType == tikwm.AssetSD || assetType == tikwm.AssetWatermarked {
 			refreshedPost, refreshErr := c.getPostWithRetry(ctx, post, nil, 0, 0) // No progress CB for internal retries
+			if errors.Is(refreshErr, tikwm.ErrRateLimited) && !c.cfg.RetryOn429 {
+				// Give up on this quality right away, so that a quality ladder falls back to the next one.
+				return fmt.Errorf("failed for post %s: %w", post.ID(), refreshErr)
+			}
 			if refreshErr != nil {
 				return c.downloadRetrying(ctx, post, assetType, filename, try+1, refreshErr, opt)
 			}
@@ -888,12 +1507,16 @@ func (c *Client) downloadRetrying(ctx context.Context, post *tikwm.Post, assetTy
 		}
 	}
 
-	url, size, err := c.getURLAndSizeForAsset(post, assetType)
+	url, size, err := c.getURLAndSizeForAsset(ctx, post, assetType)
 	if err != nil {
-		if tikwm.IsDailyRateLimitError(err) {
-			network.MarkCurrentAddressAsExhausted()
-			c.logger.Printf("Daily rate limit hit while getting source encode URL. Rotating IP and retrying.")
-			return c.downloadRetrying(ctx, post, assetType, filename, try, err, opt) // Don't increment try count for IP rotation
+		if errors.Is(err, tikwm.ErrDailyQuota) {
+			rotated := network.RotateOnDailyQuota()
+			c.logger.Printf("Daily rate limit hit while getting source encode URL. Rotating %s and retrying.", rotated)
+			return c.downloadRetrying(ctx, post, assetType, filename, try, err, opt) // Don't increment try count for rotation
+		}
+		if errors.Is(err, tikwm.ErrRateLimited) && !c.cfg.RetryOn429 {
+			// Give up on this quality right away, so that a quality ladder falls back to the next one.
+			return fmt.Errorf("failed for post %s: %w", post.ID(), err)
 		}
 		return c.downloadRetrying(ctx, post, assetType, filename, try+1, err, opt)
 	}
@@ -932,14 +1555,16 @@ func (c *Client) downloadRetrying(ctx context.Context, post *tikwm.Post, assetTy
 }
 
 // getURLAndSizeForAsset retrieves the download URL and expected size for a given asset type.
-func (c *Client) getURLAndSizeForAsset(post *tikwm.Post, assetType tikwm.AssetType) (url string, size int, err error) {
+func (c *Client) getURLAndSizeForAsset(ctx context.Context, post *tikwm.Post, assetType tikwm.AssetType) (url string, size int, err error) {
 	switch assetType {
 	case tikwm.AssetHD:
 		return post.Hdplay, post.HdSize, nil
 	case tikwm.AssetSD:
 		return post.Play, post.Size, nil
+	case tikwm.AssetWatermarked:
+		return post.Wmplay, post.WmSize, nil
 	case tikwm.AssetSource:
-		sourceInfo, err := tikwm.GetSourceEncode(post.ID())
+		sourceInfo, err := c.getSourceEncode(ctx, post.ID())
 		if err != nil {
 			return "", 0, fmt.Errorf("failed to get source encode URL: %w", err)
 		}
@@ -955,186 +1580,464 @@ func (c *Client) getURLAndSizeForAsset(post *tikwm.Post, assetType tikwm.AssetTy
 	}
 }
 
-// getUserFeed fetches the user feed and returns a channel to which posts are sent.
-// It implements a simple, time-based cache to speed up repeated runs.
-func (c *Client) getUserFeed(ctx context.Context, uniqueID string, opt *tikwm.FeedOpt) (chan tikwm.Post, int, error) {
-	opt = opt.Defaults()
+// rateLimitBackoff waits d before a rate-limited request is retried. With the adaptive rate limit, the
+// limiter has already slowed down the requests of every worker, so the retry only waits for its turn.
+func rateLimitBackoff(ctx context.Context, d time.Duration) error {
+	if tikwm.AdaptiveRateLimit {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	if c.cfg.FeedCache {
-		posts, err := c.getFeedFromCache(uniqueID, opt)
-		if err == nil {
-			// Cache hit and successful read
-			return c.postsToChannel(posts), len(posts), nil
+// getSourceEncode waits for the result of the source encode task for videoID, which is submitted
+// through the client's backend unless it was already prefetched.
+func (c *Client) getSourceEncode(ctx context.Context, videoID string) (*tikwm.SourceEncodeResult, error) {
+	return c.sources.result(ctx, videoID)
+}
+
+// prefetchSources forwards the items of a feed, prefetching the source encode of each video that
+// needs one as it passes. The returned channel's buffer bounds how far ahead of processing it reads.
+func (c *Client) prefetchSources(ctx context.Context, items <-chan feedItem, force bool) <-chan feedItem {
+	out := make(chan feedItem, c.cfg.SourcePrefetch)
+	go func() {
+		defer close(out)
+		for item := range items {
+			if !item.post.IsAlbum() {
+				exists, err := c.db.AssetExists(item.post.ID(), tikwm.AssetSource)
+				if force || (err == nil && !exists) {
+					c.sources.prefetch(ctx, item.post.ID())
+				}
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return
+			}
 		}
-		// Log cache miss/error but continue to fetch from API
-		c.logger.Printf("Cache miss for user %s: %v. Fetching from API.", uniqueID, err)
+	}()
+	return out
+}
+
+// feedPager fetches one page of a feed starting at cursor.
+type feedPager func(ctx context.Context, cursor string) (*tikwm.UserFeed, error)
+
+// getUserFeed starts fetching the user feed and returns a feed from which posts are received.
+func (c *Client) getUserFeed(ctx context.Context, uniqueID string, opt *tikwm.FeedOpt) *postFeed {
+	fetch := func(ctx context.Context, cursor string) (*tikwm.UserFeed, error) {
+		return c.backend.GetUserFeed(ctx, uniqueID, tikwm.MaxUserFeedCount, cursor)
 	}
+	return c.getFeed(ctx, uniqueID, fetch, opt)
+}
 
-	// Fetch from API if cache is disabled, missed, or failed
-	allPosts, err := c.userFeedSinceInternal(ctx, uniqueID, "0", opt, 0)
-	if err != nil {
-		return nil, 0, err
+// feedItem is a post received from a feed, along with the cursor of the page it was found in.
+type feedItem struct {
+	post   tikwm.Post
+	cursor string
+}
+
+// postFeed is a feed whose posts are received from items while its pages are still being fetched.
+type postFeed struct {
+	items  <-chan feedItem
+	key    string             // Key of the feed's checkpoint. Empty if the feed is not checkpointed. Only read after receiving from items.
+	found  atomic.Int64       // Number of posts found so far.
+	total  atomic.Int64       // Number of posts in the feed, 0 until pagination has finished.
+	err    error              // Pagination error, only valid once items is closed.
+	cancel context.CancelFunc // Stops pagination early.
+}
+
+// stop stops fetching the feed. It must be called once the feed is no longer received from.
+func (f *postFeed) stop() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// feedOrder returns the configured FeedOrder, defaulting to FeedOrderOldest.
+func (c *Client) feedOrder() string {
+	switch strings.ToLower(c.cfg.FeedOrder) {
+	case FeedOrderNewest:
+		return FeedOrderNewest
+	case FeedOrderOldest:
+		fallthrough
+	default:
+		return FeedOrderOldest
 	}
+}
+
+// newestFirst reports whether feeds are processed newest post first.
+func (c *Client) newestFirst() bool {
+	return c.feedOrder() == FeedOrderNewest
+}
 
-	// Save to cache if enabled
-	if c.cfg.FeedCache {
-		if cacheErr := c.saveFeedToCache(uniqueID, allPosts); cacheErr != nil {
-			// Log caching error but don't fail the operation
-			c.logger.Printf("Failed to write feed to cache for %s: %v", uniqueID, cacheErr)
+// getFeed starts paging through a feed with fetch and returns a feed from which posts are received.
+// With the newest-first order, posts are sent as soon as their page arrives so that downloads start immediately.
+// With the oldest-first order, the whole feed has to be fetched, and held in memory, before the oldest post is known
+// and sent.
+//
+// key identifies the feed in the feed cache and in the checkpoints table; an empty key disables both.
+// If a previous crawl of the feed was interrupted, it is resumed from its checkpoint: newest-first crawls
+// continue from the page of the last processed post, and oldest-first crawls stop paging at that post.
+func (c *Client) getFeed(ctx context.Context, key string, fetch feedPager, opt *tikwm.FeedOpt) *postFeed {
+	opt = opt.Defaults()
+	newestFirst := c.newestFirst()
+
+	checkpoint := c.loadFeedCheckpoint(key)
+	if c.cachesFeeds() && key != "" && checkpoint == nil {
+		cached, err := c.feedCache.GetCachedFeed(key)
+		switch {
+		case err != nil:
+			c.logger.Printf("Could not read cached feed %s: %v. Fetching from API.", key, err)
+		case cached == nil:
+			c.logger.Printf("Feed %s is not cached yet. Fetching from API.", key)
+		case c.fullScanDue(cached):
+			c.logger.Printf("Full scan of feed %s is due. Fetching from API.", key)
+		case c.cfg.FeedCache && time.Since(cached.SyncedAt) <= c.feedCacheTTL():
+			// Cache hit
+			c.logger.Printf("Using cached feed for %s (synced at %s)", key, cached.SyncedAt.Format(time.DateTime))
+			return c.postsFeed(filterCachedPosts(cached.Posts, opt))
+		case c.cfg.IncrementalSync:
+			return c.syncFeed(ctx, key, fetch, opt, cached)
+		default:
+			c.logger.Printf("Cache expired for feed %s. Fetching from API.", key)
 		}
 	}
 
-	return c.postsToChannel(allPosts), len(allPosts), nil
-}
+	cursor := "0"
+	if checkpoint != nil {
+		if newestFirst {
+			cursor = checkpoint.Cursor
+		} else {
+			// Posts from the checkpoint onwards are older, so they have already been processed.
+			fetch = stopAtPost(fetch, checkpoint.PostID)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	itemChan := make(chan feedItem, tikwm.MaxUserFeedCount) // Lets the next page be fetched while posts are processed.
+	feed := &postFeed{items: itemChan, key: key, cancel: cancel}
+	if newestFirst {
+		// Page progress would overwrite the progress of the posts being processed, so only the count is kept.
+		opt.OnFeedProgress = func(count int) {}
+	}
 
-// postsToChannel converts a slice of posts to a channel of posts for processing.
-func (c *Client) postsToChannel(posts []tikwm.Post) chan tikwm.Post {
-	returnChan := make(chan tikwm.Post, len(posts))
 	go func() {
-		defer close(returnChan)
-		// Reverse posts to process from oldest to newest.
-		for i := 0; i < len(posts)/2; i++ {
-			posts[i], posts[len(posts)-i-1] = posts[len(posts)-i-1], posts[i]
+		defer close(itemChan)
+		var allItems []feedItem
+		_, err := c.fetchFeed(ctx, fetch, cursor, opt, func(page []tikwm.Post, cursor string) error {
+			items := make([]feedItem, len(page))
+			for i, post := range page {
+				items[i] = feedItem{post: post, cursor: cursor}
+			}
+			allItems = append(allItems, items...)
+			feed.found.Store(int64(len(allItems)))
+			if !newestFirst {
+				return nil
+			}
+			return sendItems(ctx, itemChan, items)
+		})
+		feed.total.Store(int64(len(allItems)))
+
+		// Only complete feeds are cached, as a partial feed would hide older posts until the next full scan.
+		if err == nil && checkpoint == nil && c.cachesFeeds() && key != "" {
+			allPosts := make([]tikwm.Post, len(allItems))
+			for i, item := range allItems {
+				allPosts[i] = item.post
+			}
+			if cacheErr := c.feedCache.ReplaceCachedFeed(key, allPosts); cacheErr != nil {
+				// Log caching error but don't fail the operation
+				c.logger.Printf("Failed to write feed to cache for %s: %v", key, cacheErr)
+			}
 		}
-		for _, post := range posts {
-			returnChan <- post
+		if !newestFirst {
+			// Posts fetched before an error are still processed, from oldest to newest.
+			// They are not checkpointed, as older posts that were never fetched would be skipped on resume.
+			if err != nil {
+				feed.key = ""
+			}
+			slices.Reverse(allItems)
+			if sendErr := sendItems(ctx, itemChan, allItems); err == nil {
+				err = sendErr
+			}
 		}
+		feed.err = err
 	}()
-	return returnChan
+	return feed
 }
 
-// getFeedFromCache tries to load a user's feed from the local cache.
-func (c *Client) getFeedFromCache(uniqueID string, opt *tikwm.FeedOpt) ([]tikwm.Post, error) {
-	cachePath, err := c.getFeedCachePath(uniqueID)
-	if err != nil {
-		return nil, fmt.Errorf("could not determine cache path: %w", err)
+// postsFeed returns a feed that sends posts that were already fetched, newest first,
+// in the configured feed order. The feed is not checkpointed.
+func (c *Client) postsFeed(posts []tikwm.Post) *postFeed {
+	itemChan := make(chan feedItem, len(posts))
+	feed := &postFeed{items: itemChan}
+	feed.found.Store(int64(len(posts)))
+	feed.total.Store(int64(len(posts)))
+	if !c.newestFirst() {
+		// Reverse a copy of posts to process from oldest to newest.
+		posts = slices.Clone(posts)
+		slices.Reverse(posts)
+	}
+	for _, post := range posts {
+		itemChan <- feedItem{post: post}
+	}
+	close(itemChan)
+	return feed
+}
+
+// sendItems sends items to itemChan, giving up if ctx is cancelled.
+func sendItems(ctx context.Context, itemChan chan<- feedItem, items []feedItem) error {
+	for _, item := range items {
+		select {
+		case itemChan <- item:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+	return nil
+}
 
-	info, err := os.Stat(cachePath)
+// loadFeedCheckpoint returns the checkpoint of the feed identified by key, or nil if the crawl starts over.
+// Checkpoints saved with a different feed order cannot be resumed and are ignored.
+func (c *Client) loadFeedCheckpoint(key string) *storage.FeedCheckpoint {
+	if key == "" || c.checkpoints == nil {
+		return nil
+	}
+	checkpoint, err := c.checkpoints.GetFeedCheckpoint(key)
 	if err != nil {
-		return nil, fmt.Errorf("cache file not found: %w", err) // This is os.ErrNotExist in most cases
+		c.logger.Printf("Could not load checkpoint for feed %s: %v. Starting from the beginning.", key, err)
+		return nil
+	}
+	if checkpoint == nil {
+		return nil
+	}
+	if checkpoint.Order != c.feedOrder() {
+		c.logger.Printf("Ignoring checkpoint for feed %s saved with the %s feed order.", key, checkpoint.Order)
+		return nil
+	}
+	c.logger.Printf("Resuming feed %s from post %s (checkpoint from %s).", key, checkpoint.PostID, checkpoint.UpdatedAt.Format(time.DateTime))
+	return checkpoint
+}
+
+// saveFeedCheckpoint records item as the last processed post of a checkpointed feed.
+func (c *Client) saveFeedCheckpoint(feed *postFeed, item feedItem) {
+	if feed.key == "" || c.checkpoints == nil {
+		return
 	}
+	checkpoint := &storage.FeedCheckpoint{Target: feed.key, Cursor: item.cursor, PostID: item.post.ID(), Order: c.feedOrder()}
+	if err := c.checkpoints.SaveFeedCheckpoint(checkpoint); err != nil {
+		c.logger.Printf("Could not save checkpoint for feed %s: %v", feed.key, err)
+	}
+}
+
+// ClearProfileCheckpoint deletes the checkpoint of a user's feed, so that the next crawl starts from the beginning.
+func (c *Client) ClearProfileCheckpoint(username string) error {
+	return c.clearFeedCheckpoint(ExtractUsername(username))
+}
+
+// ClearHashtagCheckpoint deletes the checkpoint of a hashtag feed, so that the next crawl starts from the beginning.
+func (c *Client) ClearHashtagCheckpoint(tag string) error {
+	return c.clearFeedCheckpoint("#" + ExtractHashtag(tag))
+}
+
+// clearFeedCheckpoint deletes the checkpoint of the feed identified by key, if the database keeps checkpoints.
+func (c *Client) clearFeedCheckpoint(key string) error {
+	if c.checkpoints == nil {
+		return nil
+	}
+	return c.checkpoints.DeleteFeedCheckpoint(key)
+}
+
+// cachesFeeds reports whether feed listings are cached in the database.
+func (c *Client) cachesFeeds() bool {
+	return (c.cfg.FeedCache || c.cfg.IncrementalSync) && c.feedCache != nil
+}
 
+// feedCacheTTL returns how long a cached feed is used without contacting the API.
+func (c *Client) feedCacheTTL() time.Duration {
 	ttl, err := time.ParseDuration(c.cfg.FeedCacheTTL)
 	if err != nil {
 		// Fallback to a default if the config is invalid, but log it.
 		c.logger.Printf("Invalid FeedCacheTTL '%s', falling back to 1h: %v", c.cfg.FeedCacheTTL, err)
 		ttl = 1 * time.Hour
 	}
+	return ttl
+}
 
-	if time.Since(info.ModTime()) > ttl {
-		return nil, fmt.Errorf("cache expired (older than %s)", c.cfg.FeedCacheTTL)
+// fullScanDue reports whether a cached feed should be paged through entirely, as configured by FullRescanInterval.
+func (c *Client) fullScanDue(cached *storage.CachedFeed) bool {
+	interval, err := time.ParseDuration(c.cfg.FullRescanInterval)
+	if err != nil {
+		c.logger.Printf("Invalid FullRescanInterval '%s', falling back to 168h: %v", c.cfg.FullRescanInterval, err)
+		interval = 168 * time.Hour
 	}
+	return cached.FullScanAt.IsZero() || time.Since(cached.FullScanAt) >= interval
+}
 
-	c.logger.Printf("Using cached feed for %s (from %s)", uniqueID, cachePath)
-	data, err := os.ReadFile(cachePath) // #nosec G304
-	if err != nil {
-		return nil, fmt.Errorf("failed to read cache file: %w", err)
+// syncFeed pages through a feed newest first until it reaches posts that are already cached, merges the new posts
+// into the cache and returns a feed of the whole cached listing, so that posts whose download failed are retried.
+// Paging stops once more than SyncOverlap consecutive cached posts have been read, which steps over pinned posts.
+func (c *Client) syncFeed(ctx context.Context, key string, fetch feedPager, opt *tikwm.FeedOpt, cached *storage.CachedFeed) *postFeed {
+	known := make(map[string]bool, len(cached.Posts))
+	for _, post := range cached.Posts {
+		known[post.ID()] = true
+	}
+	overlap := max(0, c.cfg.SyncOverlap)
+	consecutive := 0
+	syncOpt := *opt
+	syncOpt.While = func(post *tikwm.Post) bool {
+		if !opt.While(post) {
+			return false
+		}
+		if post.IsPinned() {
+			return true // Pinned posts don't tell where the new posts end.
+		}
+		if !known[post.ID()] {
+			consecutive = 0
+			return true
+		}
+		consecutive++
+		return consecutive <= overlap
 	}
+	syncOpt.OnFeedProgress = func(count int) {}
 
-	var cachedPosts []tikwm.Post
-	if err := json.Unmarshal(data, &cachedPosts); err != nil {
-		return nil, fmt.Errorf("failed to parse cache file: %w", err)
+	c.logger.Printf("Syncing feed %s incrementally (last synced at %s).", key, cached.SyncedAt.Format(time.DateTime))
+	fetched, err := c.collectFeed(ctx, fetch, &syncOpt)
+	if err != nil {
+		// Merging a partial sync would leave a gap that later syncs never fill, so only the cache is processed.
+		feed := c.postsFeed(filterCachedPosts(cached.Posts, opt))
+		feed.err = fmt.Errorf("incremental sync of feed %s failed: %w", key, err)
+		return feed
+	}
+	if err := c.feedCache.MergeCachedFeed(key, fetched); err != nil {
+		c.logger.Printf("Failed to merge new posts into cached feed %s: %v", key, err)
+	}
+
+	merged := make([]tikwm.Post, 0, len(fetched)+len(cached.Posts))
+	fetchedIDs := make(map[string]bool, len(fetched))
+	newPosts := 0
+	for _, post := range fetched {
+		merged = append(merged, post)
+		fetchedIDs[post.ID()] = true
+		if !known[post.ID()] {
+			newPosts++
+		}
 	}
+	for _, post := range cached.Posts {
+		if !fetchedIDs[post.ID()] {
+			merged = append(merged, post)
+		}
+	}
+	c.logger.Printf("Incremental sync of feed %s found %d new posts.", key, newPosts)
+	return c.postsFeed(filterCachedPosts(merged, opt))
+}
 
-	// Filter the cached posts based on the current run's options (e.g., a new --since date).
-	// The cached posts are sorted newest to oldest, so we can break early.
+// filterCachedPosts applies the current run's options (e.g., a new since date) to cached posts.
+// The cached posts are in feed order, so we can break early.
+func filterCachedPosts(posts []tikwm.Post, opt *tikwm.FeedOpt) []tikwm.Post {
 	var filteredPosts []tikwm.Post
-	for _, post := range cachedPosts {
-		if !opt.While(&post) {
+	walk := opt.Walker()
+	for _, post := range posts {
+		pass, end := walk(&post)
+		if end {
 			break
 		}
-		if !opt.Filter(&post) {
+		if !pass || !opt.Filter(&post) {
 			continue
 		}
 		filteredPosts = append(filteredPosts, post)
 	}
-
 	opt.OnFeedProgress(len(filteredPosts))
-	return filteredPosts, nil
+	return filteredPosts
 }
 
-// saveFeedToCache writes a user's feed to a local cache file.
-func (c *Client) saveFeedToCache(uniqueID string, posts []tikwm.Post) error {
-	cachePath, err := c.getFeedCachePath(uniqueID)
-	if err != nil {
-		return fmt.Errorf("could not determine cache path: %w", err)
-	}
-
-	c.logger.Printf("Saving feed for %s to cache: %s", uniqueID, cachePath)
-	if err := os.MkdirAll(filepath.Dir(cachePath), 0750); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
-	}
-
-	data, err := json.Marshal(posts)
-	if err != nil {
-		return fmt.Errorf("failed to serialize feed for caching: %w", err)
-	}
-
-	// #nosec G306
-	if err := os.WriteFile(cachePath, data, 0640); err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
+// stopAtPost returns a feedPager that ends the feed fetched by fetch right before the post with the given ID.
+func stopAtPost(fetch feedPager, postID string) feedPager {
+	return func(ctx context.Context, cursor string) (*tikwm.UserFeed, error) {
+		feed, err := fetch(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for i, post := range feed.Videos {
+			if post.ID() == postID {
+				feed.Videos = feed.Videos[:i]
+				feed.HasMore = false
+				break
+			}
+		}
+		return feed, nil
 	}
-	return nil
 }
 
-// getFeedCachePath returns the path to the feed cache file for a specific user.
-func (c *Client) getFeedCachePath(username string) (string, error) {
-	return xdg.CacheFile(filepath.Join("tikwm", "feeds", username+".json"))
+// collectFeed pages through a feed and returns the posts accepted by opt, newest first.
+// If an error occurs, the posts fetched before it are returned along with the error.
+func (c *Client) collectFeed(ctx context.Context, fetch feedPager, opt *tikwm.FeedOpt) ([]tikwm.Post, error) {
+	var posts []tikwm.Post
+	_, err := c.fetchFeed(ctx, fetch, "0", opt.Defaults(), func(page []tikwm.Post, cursor string) error {
+		posts = append(posts, page...)
+		return nil
+	})
+	return posts, err
 }
 
-// userFeedSinceInternal is a recursive function that fetches user feed posts since a given cursor.
-func (c *Client) userFeedSinceInternal(ctx context.Context, uniqueID string, cursor string, opt *tikwm.FeedOpt, currentCount int) ([]tikwm.Post, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-	}
-
-	feed, err := tikwm.GetUserFeedRaw(uniqueID, tikwm.MaxUserFeedCount, cursor)
-	if err != nil {
-		if tikwm.IsDailyRateLimitError(err) {
-			network.MarkCurrentAddressAsExhausted()
-			opt.OnError(fmt.Errorf("daily rate limit hit. Rotating IP and retrying feed from cursor %s", cursor))
-			// Retry the same request. The network manager will use the next available IP.
-			return c.userFeedSinceInternal(ctx, uniqueID, cursor, opt, currentCount)
+// fetchFeed pages through a feed starting at cursor and passes the posts accepted by opt to onPage as each page arrives,
+// along with the cursor the page was fetched with.
+// It stops when the feed ends, opt.While ends it (see FeedOpt.Walker), or onPage returns an error, and returns the number of posts accepted.
+func (c *Client) fetchFeed(ctx context.Context, fetch feedPager, cursor string, opt *tikwm.FeedOpt, onPage func(page []tikwm.Post, cursor string) error) (int, error) {
+	count := 0
+	walk := opt.Walker()
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
 		}
 
-		if strings.Contains(err.Error(), "(-1)") || strings.Contains(err.Error(), "(429)") {
-			if c.cfg.RetryOn429 {
+		feed, err := fetch(ctx, cursor)
+		if err != nil {
+			if errors.Is(err, tikwm.ErrDailyQuota) {
+				rotated := network.RotateOnDailyQuota()
+				opt.OnError(fmt.Errorf("daily rate limit hit. Rotating %s and retrying feed from cursor %s", rotated, cursor))
+				// Retry the same request. The network manager will use the next available IP or API key.
+				continue
+			}
+
+			if errors.Is(err, tikwm.ErrRateLimited) && c.cfg.RetryOn429 {
 				opt.OnError(fmt.Errorf("rate limited, retrying feed from cursor %s", cursor))
-				select {
-				case <-time.After(2 * time.Second): // Wait and retry the same request
-					return c.userFeedSinceInternal(ctx, uniqueID, cursor, opt, currentCount)
-				case <-ctx.Done():
-					return nil, ctx.Err()
+				if err := rateLimitBackoff(ctx, 2*time.Second); err != nil {
+					return count, err
 				}
+				continue // Retry the same request
 			}
+			return count, err
 		}
-		return nil, err
-	}
+		c.recordPostStats(feed.Videos)
+
+		page := make([]tikwm.Post, 0, len(feed.Videos))
+		done := !feed.HasMore
+		for i := range feed.Videos {
+			vid := &feed.Videos[i]
+			pass, end := walk(vid)
+			if end {
+				done = true
+				break
+			}
+			if pass && opt.Filter(vid) {
+				page = append(page, *vid)
+			}
+		}
+		count += len(page)
+		opt.OnFeedProgress(count)
 
-	ret := []tikwm.Post{}
-	for _, vid := range feed.Videos {
-		if !opt.While(&vid) {
-			opt.OnFeedProgress(currentCount + len(ret))
-			return ret, nil
+		if len(page) > 0 {
+			if err := onPage(page, cursor); err != nil {
+				return count, err
+			}
 		}
-		if !opt.Filter(&vid) {
-			continue
+		if done {
+			return count, nil
 		}
-		ret = append(ret, vid)
-	}
-
-	newTotal := currentCount + len(ret)
-	opt.OnFeedProgress(newTotal)
-
-	if !feed.HasMore {
-		return ret, nil
-	}
-	deeperRet, err := c.userFeedSinceInternal(ctx, uniqueID, feed.Cursor, opt, newTotal)
-	if err != nil {
-		return ret, err
+		cursor = feed.Cursor
 	}
-	return append(ret, deeperRet...), nil
 }
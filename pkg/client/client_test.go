@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/config"
+	"github.com/perpetuallyhorni/tikwm/pkg/storage/sqlite"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm/tikwmtest"
+)
+
+// testUser is the creator whose posts the tests download.
+const testUser = "some_user"
+
+func TestMain(m *testing.M) {
+	// Feeds are paged through a few posts at a time, with barely any delay between requests.
+	tikwm.RequestDelay = time.Millisecond
+	tikwm.MaxRequestDelay = 10 * time.Millisecond
+	tikwm.MaxUserFeedCount = 4
+	ctx, cancel := context.WithCancel(context.Background())
+	tikwm.InitRateLimiter(ctx)
+	code := m.Run()
+	tikwm.StopRateLimiter()
+	cancel()
+	os.Exit(code)
+}
+
+// testPosts returns n video posts of testUser, one hour apart, oldest first.
+func testPosts(n int) []tikwm.Post {
+	posts := make([]tikwm.Post, n)
+	for i := range posts {
+		posts[i] = tikwm.Post{Id: fmt.Sprint(7000000000000000000 + i), CreateTime: int64(1700000000 + i*3600), Title: fmt.Sprintf("post %d", i)}
+	}
+	return posts
+}
+
+// newTestClient returns a client that talks to srv and downloads to a temporary directory, with a temporary database.
+// Only videos are downloaded, in quality, and ffmpeg validation and the feed cache are disabled.
+func newTestClient(t *testing.T, srv *tikwmtest.Server, quality string) (*Client, *sqlite.DB) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := sqlite.New(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatalf("sqlite.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	cfg := config.Default()
+	cfg.DownloadPath = filepath.Join(dir, "downloads")
+	cfg.Quality = quality
+	cfg.FfmpegPath = ""
+	cfg.FeedCache = false
+	c, err := NewWithBackend(cfg, db, log.New(io.Discard, "", 0), srv.Backend())
+	if err != nil {
+		t.Fatalf("NewWithBackend: %v", err)
+	}
+	return c, db
+}
+
+// checkDownloaded fails the test unless every post was downloaded in quality, both on disk and in the database.
+func checkDownloaded(t *testing.T, c *Client, db *sqlite.DB, posts []tikwm.Post, quality tikwm.AssetType) {
+	t.Helper()
+	for _, post := range posts {
+		post.Author.UniqueId = testUser
+		data, err := os.ReadFile(c.getAssetPath(&post, quality))
+		if err != nil {
+			t.Errorf("post %s: %v", post.ID(), err)
+			continue
+		}
+		if want := fmt.Sprintf("tikwmtest media %s %s\n", post.ID(), quality); string(data) != want {
+			t.Errorf("post %s: downloaded %q, want %q", post.ID(), data, want)
+		}
+		exists, err := db.AssetExists(post.ID(), quality)
+		if err != nil || !exists {
+			t.Errorf("post %s: %s not recorded in the database (err: %v)", post.ID(), quality, err)
+		}
+	}
+}
+
+func TestDownloadProfilePagesThroughRateLimitedFeed(t *testing.T) {
+	srv := tikwmtest.NewServer()
+	defer srv.Close()
+	posts := testPosts(10)
+	srv.AddPosts(testUser, posts...)
+
+	for _, order := range []string{FeedOrderOldest, FeedOrderNewest} {
+		t.Run(order, func(t *testing.T) {
+			before := srv.Requests(tikwmtest.EndpointUserFeed)
+			srv.Fail(tikwmtest.EndpointUserFeed, tikwmtest.RateLimited, 1)
+			c, db := newTestClient(t, srv, "hd")
+			c.cfg.RetryOn429 = true
+			c.cfg.FeedOrder = order
+			if err := c.DownloadProfile(context.Background(), testUser, false, c.logger, nil); err != nil {
+				t.Fatalf("DownloadProfile: %v", err)
+			}
+			checkDownloaded(t, c, db, posts, tikwm.AssetHD)
+
+			// 10 posts take 3 pages of 4, plus the rate-limited request that was retried.
+			if got := srv.Requests(tikwmtest.EndpointUserFeed) - before; got != 4 {
+				t.Errorf("made %d feed requests, want 4", got)
+			}
+		})
+	}
+}
+
+func TestFixProfileDownloadsMissingQuality(t *testing.T) {
+	srv := tikwmtest.NewServer()
+	defer srv.Close()
+	posts := testPosts(3)
+	srv.AddPosts(testUser, posts...)
+
+	c, db := newTestClient(t, srv, "hd")
+	ctx := context.Background()
+	if err := c.DownloadProfile(ctx, testUser, false, c.logger, nil); err != nil {
+		t.Fatalf("DownloadProfile: %v", err)
+	}
+	c.cfg.Quality = "sd"
+	if err := c.FixProfile(ctx, testUser, c.logger, nil); err != nil {
+		t.Fatalf("FixProfile: %v", err)
+	}
+	checkDownloaded(t, c, db, posts, tikwm.AssetSD)
+	if got := srv.Requests(tikwmtest.EndpointPost); got != len(posts) {
+		t.Errorf("FixProfile looked up %d posts, want %d", got, len(posts))
+	}
+
+	// Nothing is missing anymore, so a second fix does nothing.
+	if err := c.FixProfile(ctx, testUser, c.logger, nil); err != nil {
+		t.Fatalf("second FixProfile: %v", err)
+	}
+	if got := srv.Requests(tikwmtest.EndpointPost); got != len(posts) {
+		t.Errorf("second FixProfile looked up %d more posts, want none", got-len(posts))
+	}
+}
+
+func TestDownloadProfileWaitsForSlowSourceEncodes(t *testing.T) {
+	const polls = 2
+	for _, prefetch := range []int{0, 2} {
+		t.Run(fmt.Sprintf("prefetch=%d", prefetch), func(t *testing.T) {
+			srv := tikwmtest.NewServer()
+			defer srv.Close()
+			posts := testPosts(3)
+			srv.AddPosts(testUser, posts...)
+			srv.SetSourceEncodePolls(polls)
+
+			c, db := newTestClient(t, srv, "source")
+			c.cfg.SourcePrefetch = prefetch
+			if err := c.DownloadProfile(context.Background(), testUser, false, c.logger, nil); err != nil {
+				t.Fatalf("DownloadProfile: %v", err)
+			}
+			checkDownloaded(t, c, db, posts, tikwm.AssetSource)
+
+			if got := srv.Requests(tikwmtest.EndpointSourceSubmit); got != len(posts) {
+				t.Errorf("submitted %d source encode tasks, want %d", got, len(posts))
+			}
+			// Each task stays pending for polls polls, then completes on the next one.
+			if got, want := srv.Requests(tikwmtest.EndpointSourceResult), len(posts)*(polls+1); got != want {
+				t.Errorf("polled source encode tasks %d times, want %d", got, want)
+			}
+			tasks, err := db.GetSourceTasks()
+			if err != nil {
+				t.Fatalf("GetSourceTasks: %v", err)
+			}
+			if len(tasks) != 0 {
+				t.Errorf("%d source encode tasks left in the database after their downloads", len(tasks))
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// postMetadataVersion is the version of the layout of info.json sidecar files.
+// It is increased when the layout changes, so that sidecars written with an older layout are rewritten.
+const postMetadataVersion = 1
+
+// postMetadata is the content of a post's info.json sidecar file.
+type postMetadata struct {
+	Version   int             `json:"version"`
+	PostID    string          `json:"post_id"`
+	SavedAt   time.Time       `json:"saved_at"`   // When the sidecar was first written.
+	UpdatedAt time.Time       `json:"updated_at"` // When the sidecar was last refreshed.
+	Stats     postStats       `json:"stats"`      // Stats of the post when the sidecar was last refreshed.
+	Assets    []assetMetadata `json:"assets"`     // Downloaded assets of the post, as recorded in the database.
+	Post      json.RawMessage `json:"post"`       // The post as returned by the API.
+}
+
+// postStats are the counters of a post that change over time.
+type postStats struct {
+	PlayCount     int `json:"play_count"`
+	DiggCount     int `json:"digg_count"`
+	CommentCount  int `json:"comment_count"`
+	ShareCount    int `json:"share_count"`
+	DownloadCount int `json:"download_count"`
+	CollectCount  int `json:"collect_count"`
+}
+
+// assetMetadata is a downloaded asset listed in an info.json sidecar.
+type assetMetadata struct {
+	ID           string          `json:"id,omitempty"` // ID is the ID of an album photo, "<post ID>_<photo>_<photos>".
+	Type         tikwm.AssetType `json:"type"`
+	SHA256       string          `json:"sha256"`
+	DownloadedAt time.Time       `json:"downloaded_at"`
+}
+
+// statsOf returns the stats of post.
+func statsOf(post *tikwm.Post) postStats {
+	return postStats{
+		PlayCount:     post.PlayCount,
+		DiggCount:     post.DiggCount,
+		CommentCount:  post.CommentCount,
+		ShareCount:    post.ShareCount,
+		DownloadCount: post.DownloadCount,
+		CollectCount:  post.CollectCount,
+	}
+}
+
+// getMetadataPath returns the path of the info.json sidecar file for a post.
+func (c *Client) getMetadataPath(post *tikwm.Post) string {
+	return filepath.Join(c.postDir(c.cfg.DownloadPath, post), c.postBaseName(post)+".info.json")
+}
+
+// ensurePostMetadata saves a post's API payload, along with the assets downloaded for it, to an info.json sidecar
+// next to its media. An existing sidecar is only refreshed when the post's stats or downloaded assets have changed.
+func (c *Client) ensurePostMetadata(post *tikwm.Post, force bool, logger *log.Logger) error {
+	if c.metadata == nil {
+		return nil // The assets listed in the sidecar are read from the database.
+	}
+	records, err := c.metadata.GetPostAssets(post.ID())
+	if err != nil {
+		return err
+	}
+	metadataPath := c.getMetadataPath(post)
+	var previous postMetadata
+	data, err := os.ReadFile(metadataPath) // #nosec G304
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &previous); err != nil {
+			logger.Printf("Could not parse metadata file %s, rebuilding it: %v", metadataPath, err)
+			previous = postMetadata{}
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read metadata file %s: %w", metadataPath, err)
+	}
+
+	metadata := postMetadata{
+		Version:   postMetadataVersion,
+		PostID:    post.ID(),
+		SavedAt:   previous.SavedAt,
+		UpdatedAt: time.Now().UTC(),
+		Stats:     statsOf(post),
+		Post:      post.Raw,
+	}
+	if metadata.SavedAt.IsZero() {
+		metadata.SavedAt = metadata.UpdatedAt
+	}
+	for _, record := range records {
+		asset := assetMetadata{Type: record.Type, SHA256: record.SHA256, DownloadedAt: record.DownloadedAt.UTC()}
+		if record.ID != post.ID() {
+			asset.ID = record.ID
+		}
+		// The database only keeps when a post was last downloaded, so keep the time each asset was first seen.
+		for _, known := range previous.Assets {
+			if known.ID == asset.ID && known.Type == asset.Type && known.SHA256 == asset.SHA256 {
+				asset.DownloadedAt = known.DownloadedAt
+			}
+		}
+		metadata.Assets = append(metadata.Assets, asset)
+	}
+	if !force && previous.Version == postMetadataVersion && previous.Stats == metadata.Stats && slices.Equal(previous.Assets, metadata.Assets) {
+		return nil // Nothing changed since the last run.
+	}
+	if len(metadata.Post) == 0 {
+		// Posts that were not decoded from an API response, e.g. built by library users.
+		if metadata.Post, err = json.Marshal(post); err != nil {
+			return fmt.Errorf("failed to serialize post %s: %w", post.ID(), err)
+		}
+	}
+
+	data, err = json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize metadata: %w", err)
+	}
+	// #nosec G301
+	if err := os.MkdirAll(filepath.Dir(metadataPath), 0755); err != nil {
+		return fmt.Errorf("failed to create creator directory: %w", err)
+	}
+	if err := writeFileAtomic(metadataPath, data); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+	logger.Printf("Saved metadata for post %s to %s", post.ID(), metadataPath)
+	return nil
+}
@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// Playlist kinds returned by ParsePlaylistURL.
+const (
+	// PlaylistMix is a creator's playlist, called a "mix" by the API.
+	PlaylistMix = "playlist"
+	// PlaylistCollection is a user's collection of posts.
+	PlaylistCollection = "collection"
+)
+
+// playlistManifestName is the name of the manifest file written to a playlist's directory.
+const playlistManifestName = "manifest.json"
+
+// Playlist identifies a playlist (mix) or collection.
+type Playlist struct {
+	Kind  string // PlaylistMix or PlaylistCollection.
+	Owner string // Username of the playlist's owner.
+	Name  string // Name of the playlist, as found in its URL.
+	ID    string // Mix or collection ID.
+}
+
+// ParsePlaylistURL parses a playlist or collection URL,
+// e.g. https://www.tiktok.com/@some_user/playlist/Some-Name-7234567890123456789.
+func ParsePlaylistURL(target string) (*Playlist, error) {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist URL '%s': %w", target, err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "@") || (parts[1] != PlaylistMix && parts[1] != PlaylistCollection) {
+		return nil, fmt.Errorf("'%s' is not a playlist or collection URL", target)
+	}
+	// The last path element is the playlist name followed by its numeric ID.
+	name, id := "", parts[2]
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		name, id = id[:i], id[i+1:]
+	}
+	if id == "" || strings.Trim(id, "0123456789") != "" {
+		return nil, fmt.Errorf("could not find a playlist ID in '%s'", target)
+	}
+	return &Playlist{Kind: parts[1], Owner: strings.TrimPrefix(parts[0], "@"), Name: name, ID: id}, nil
+}
+
+// URL returns the TikTok URL of the playlist.
+func (p *Playlist) URL() string {
+	slug := p.ID
+	if p.Name != "" {
+		slug = p.Name + "-" + p.ID
+	}
+	return fmt.Sprintf("https://www.tiktok.com/@%s/%s/%s", p.Owner, p.Kind, url.PathEscape(slug))
+}
+
+// dirName returns the name of the directory in which the playlist is stored, inside its owner's directory.
+func (p *Playlist) dirName() string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, p.Name)
+	if name == "" {
+		return fmt.Sprintf("%s_%s", p.Kind, p.ID)
+	}
+	return fmt.Sprintf("%s_%s_%s", p.Kind, name, p.ID)
+}
+
+// playlistManifest is the content of a playlist's manifest file.
+type playlistManifest struct {
+	Kind      string         `json:"kind"`
+	Owner     string         `json:"owner"`
+	Name      string         `json:"name"`
+	ID        string         `json:"id"`
+	URL       string         `json:"url"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Items     []playlistItem `json:"items"` // Items lists the posts in playlist order.
+}
+
+// playlistItem is a single post in a playlist manifest.
+type playlistItem struct {
+	Position   int      `json:"position"`
+	ID         string   `json:"id"`
+	Author     string   `json:"author"`
+	Title      string   `json:"title"`
+	CreateTime int64    `json:"create_time"`
+	Files      []string `json:"files"` // Files of the post in the playlist directory. Empty if the post was archived elsewhere first.
+}
+
+// DownloadPlaylist downloads a playlist (mix) or collection from its URL.
+// Posts are stored in a directory named after the playlist inside the owner's directory, with filenames
+// prefixed by their position so that the playlist order is kept, and a manifest.json lists the posts in order.
+// Posts older than the since date are listed in the manifest but not downloaded.
+func (c *Client) DownloadPlaylist(ctx context.Context, playlistURL string, force bool, logger *log.Logger, progressCb ProgressCallback) error {
+	if progressCb == nil {
+		progressCb = noOpProgress
+	}
+	playlist, err := ParsePlaylistURL(playlistURL)
+	if err != nil {
+		return err
+	}
+	qualitiesNeeded, err := c.getQualitiesToDownload()
+	if err != nil {
+		return err
+	}
+	since, err := time.Parse(time.DateTime, c.cfg.Since)
+	if err != nil {
+		return fmt.Errorf("invalid since date format: %w", err)
+	}
+
+	feedOpt := &tikwm.FeedOpt{
+		OnError: func(err error) {
+			logger.Printf("Error during %s fetch for '%s': %v", playlist.Kind, playlist.ID, err)
+		},
+		OnFeedProgress: func(count int) {
+			progressCb(count, 0, fmt.Sprintf("%d posts found", count))
+		},
+	}
+	fetch := func(ctx context.Context, cursor string) (*tikwm.UserFeed, error) {
+		if playlist.Kind == PlaylistCollection {
+			return c.backend.GetCollectionFeed(ctx, playlist.ID, tikwm.MaxUserFeedCount, cursor)
+		}
+		return c.backend.GetMixFeed(ctx, playlist.ID, tikwm.MaxUserFeedCount, cursor)
+	}
+	// The whole playlist is always fetched so that positions match the playlist, whatever the since date.
+	posts, err := c.collectFeed(ctx, fetch, feedOpt)
+	if err != nil {
+		return err
+	}
+	if len(posts) == 0 {
+		logger.Printf("%s %s is empty.", playlist.Kind, playlist.ID)
+		progressCb(0, 0, "No posts found.")
+		return nil
+	}
+
+	positions := make(map[string]int, len(posts))
+	for i, post := range posts {
+		if _, ok := positions[post.ID()]; !ok {
+			positions[post.ID()] = i + 1
+		}
+	}
+	width := max(3, len(strconv.Itoa(len(posts))))
+
+	plClient := c.inSubdir(path.Join(playlist.Owner, playlist.dirName()))
+	plClient.flat = true
+	plClient.filePrefix = func(post *tikwm.Post) string {
+		return fmt.Sprintf("%0*d_", width, positions[post.ID()])
+	}
+
+	var toDownload []tikwm.Post
+	after := tikwm.WhileAfter(since)
+	for i := range posts {
+		if after(&posts[i]) {
+			toDownload = append(toDownload, posts[i])
+		}
+	}
+	sourceType := storage.SourcePlaylist
+	if playlist.Kind == PlaylistCollection {
+		sourceType = storage.SourceCollection
+	}
+	recordSource := func(post *tikwm.Post) {
+		c.recordPostSource(post, sourceType, playlist.ID, logger)
+	}
+	procErr := plClient.processFeed(ctx, playlist.Kind+" "+playlist.ID, plClient.postsFeed(toDownload), qualitiesNeeded, force, logger, progressCb, recordSource)
+	if errors.Is(procErr, tikwm.ErrDiskSpace) || errors.Is(procErr, context.Canceled) {
+		return procErr
+	}
+	if err := plClient.writePlaylistManifest(playlist, posts, positions); err != nil {
+		logger.Printf("Could not write manifest for %s %s: %v", playlist.Kind, playlist.ID, err)
+		if procErr == nil {
+			procErr = err
+		}
+	}
+	return procErr
+}
+
+// postIDOfFile returns the ID of the post a file belongs to, which follows the post's creation date in the names
+// of post files ("<position>_<author>_<date>_<id>..."), or "" if the name has no creation date.
+func postIDOfFile(name string) string {
+	fields := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '.' })
+	for i := len(fields) - 2; i >= 0; i-- {
+		if _, err := time.Parse(time.DateOnly, fields[i]); err == nil {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// writePlaylistManifest writes the manifest of a playlist to the client's download path,
+// listing the posts in playlist order along with their files.
+func (c *Client) writePlaylistManifest(playlist *Playlist, posts []tikwm.Post, positions map[string]int) error {
+	dir := c.cfg.DownloadPath
+	// #nosec G301
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create playlist directory %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list playlist directory %s: %w", dir, err)
+	}
+	// Files are matched by post ID rather than by position, as posts that were already downloaded keep the
+	// position they had then, even if the playlist was reordered since.
+	files := make(map[string][]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		if id := postIDOfFile(name); id != "" {
+			files[id] = append(files[id], name)
+		}
+	}
+
+	manifest := playlistManifest{
+		Kind:      playlist.Kind,
+		Owner:     playlist.Owner,
+		Name:      playlist.Name,
+		ID:        playlist.ID,
+		URL:       playlist.URL(),
+		UpdatedAt: time.Now().UTC(),
+		Items:     make([]playlistItem, 0, len(posts)),
+	}
+	for i, post := range posts {
+		position := i + 1
+		if positions[post.ID()] != position {
+			continue // Duplicate entry, already listed at its first position.
+		}
+		manifest.Items = append(manifest.Items, playlistItem{
+			Position:   position,
+			ID:         post.ID(),
+			Author:     post.Author.UniqueId,
+			Title:      post.Title,
+			CreateTime: post.CreateTime,
+			Files:      append([]string{}, files[post.ID()]...),
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	manifestPath := filepath.Join(dir, playlistManifestName)
+	// #nosec G306
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
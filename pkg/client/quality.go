@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// ladderSeparator separates the rungs of a quality ladder in the Quality setting, e.g. "source>hd>sd".
+const ladderSeparator = ">"
+
+// Fallback is a video that could not be downloaded in the best quality of the quality ladder.
+type Fallback struct {
+	PostID string
+	Wanted tikwm.AssetType // Wanted is the best rung of the ladder.
+	Got    tikwm.AssetType // Got is the rung the video has instead, or "" if no rung could be downloaded.
+	Err    error           // Err is why the better rungs could not be downloaded.
+}
+
+// fallbackLog collects the fallbacks of a run.
+type fallbackLog struct {
+	mu        sync.Mutex
+	fallbacks []Fallback
+}
+
+// add records a fallback.
+func (l *fallbackLog) add(fallback Fallback) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fallbacks = append(l.fallbacks, fallback)
+}
+
+// take returns the recorded fallbacks and forgets them.
+func (l *fallbackLog) take() []Fallback {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fallbacks := l.fallbacks
+	l.fallbacks = nil
+	return fallbacks
+}
+
+// TakeFallbacks returns the videos that were downloaded in a lower rung of the quality ladder than the best one,
+// or in none at all, since the previous call, and forgets them. It is meant for run summaries.
+func (c *Client) TakeFallbacks() []Fallback {
+	return c.fallbacks.take()
+}
+
+// isLadder reports whether the Quality setting is a quality ladder, of which only the best rung that can be
+// downloaded is kept, rather than a set of qualities that are all downloaded.
+func (c *Client) isLadder() bool {
+	return strings.Contains(c.cfg.Quality, ladderSeparator)
+}
+
+// heldRung returns the best rung of ladder that the post already has in the database, or "" if it has none.
+func (c *Client) heldRung(postID string, ladder []tikwm.AssetType) (tikwm.AssetType, error) {
+	for _, quality := range ladder {
+		exists, err := c.db.AssetExists(postID, quality)
+		if err != nil {
+			return "", fmt.Errorf("db check failed for post %s, quality %s: %w", postID, quality, err)
+		}
+		if exists {
+			return quality, nil
+		}
+	}
+	return "", nil
+}
+
+// downloadLadder downloads the video of post in the best rung of ladder that succeeds, trying the rungs in order
+// with download until held, the rung the post already has, if any. The rung obtained is recorded in the database,
+// and a fallback is recorded if it is not the best one.
+// If no rung better than held can be downloaded, the post keeps held, and an error is only returned without one.
+func (c *Client) downloadLadder(ctx context.Context, post *tikwm.Post, ladder []tikwm.AssetType, held tikwm.AssetType, logger *log.Logger, download func(quality tikwm.AssetType) error) error {
+	if held == ladder[0] {
+		return nil
+	}
+	var errs []error
+	for i, quality := range ladder {
+		if quality == held {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := download(quality)
+		if err == nil {
+			if c.qualities != nil {
+				if err := c.qualities.SetPostQuality(post.ID(), quality); err != nil {
+					logger.Printf("Could not record quality %s for post %s: %v", quality, post.ID(), err)
+				}
+			}
+			if i > 0 {
+				logger.Printf("Downloaded post %s in %s quality instead of %s.", post.ID(), quality, ladder[0])
+				c.fallbacks.add(Fallback{PostID: post.ID(), Wanted: ladder[0], Got: quality, Err: errors.Join(errs...)})
+			}
+			return nil
+		}
+		if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
+			return err
+		}
+		logger.Printf("Could not download post %s in %s quality: %v", post.ID(), quality, err)
+		errs = append(errs, fmt.Errorf("%s: %w", quality, err))
+	}
+
+	err := errors.Join(errs...)
+	c.fallbacks.add(Fallback{PostID: post.ID(), Wanted: ladder[0], Got: held, Err: err})
+	if held != "" {
+		logger.Printf("Post %s keeps its %s quality, no better quality could be downloaded.", post.ID(), held)
+		return nil
+	}
+	return fmt.Errorf("no quality of post %s could be downloaded: %w", post.ID(), err)
+}
+
+// ensureVideoLadder makes sure that the video of post is downloaded in the best rung of ladder that succeeds.
+// Unless force is set, a post that already has a rung is left as it is; FixProfile upgrades it.
+func (c *Client) ensureVideoLadder(ctx context.Context, post *tikwm.Post, ladder []tikwm.AssetType, force bool, logger *log.Logger) error {
+	if !force {
+		held, err := c.heldRung(post.ID(), ladder)
+		if err != nil {
+			return err
+		}
+		if held != "" {
+			logger.Printf("Post %s already has %s quality in database. Skipping.", post.ID(), held)
+			return nil
+		}
+	}
+	return c.downloadLadder(ctx, post, ladder, "", logger, func(quality tikwm.AssetType) error {
+		return c.ensureVideoAsset(ctx, post, quality, force, logger)
+	})
+}
+
+// fixLadder upgrades the videos of a user that are in the database without the best rung of ladder,
+// trying the rungs better than the one each video has.
+func (c *Client) fixLadder(ctx context.Context, username string, ladder []tikwm.AssetType, logger *log.Logger, progressCb ProgressCallback) error {
+	progressCb(0, 0, fmt.Sprintf("Checking database for videos without %s quality...", ladder[0]))
+	missingPosts, err := c.db.GetMissingPostsByAuthor(username, ladder[0])
+	if err != nil {
+		return fmt.Errorf("failed to get missing posts from DB for %s: %w", username, err)
+	}
+	if len(missingPosts) == 0 {
+		progressCb(0, 0, fmt.Sprintf("No videos without %s quality found for %s.", ladder[0], username))
+		return nil
+	}
+	progressCb(0, len(missingPosts), fmt.Sprintf("Found %d videos without %s quality.", len(missingPosts), ladder[0]))
+	for i, record := range missingPosts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progressCb(i+1, len(missingPosts), "Processing "+record.ID)
+		post, err := c.getPostWithRetry(ctx, &tikwm.Post{Id: record.ID}, progressCb, i+1, len(missingPosts))
+		if err != nil {
+			logger.Printf("Could not get post details for %s: %v", record.ID, err)
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			continue
+		}
+		// Rungs the post already has are not downloaded again, so a video downloaded before the ladder was
+		// configured keeps the rung it has if no better one can be downloaded.
+		err = c.downloadLadder(ctx, post, ladder, record.Quality, logger, func(quality tikwm.AssetType) error {
+			return c.ensureVideoAsset(ctx, post, quality, false, logger)
+		})
+		if err != nil {
+			logger.Printf("Failed to process video for post %s: %v", post.ID(), err)
+			if errors.Is(err, tikwm.ErrDiskSpace) || errors.Is(err, context.Canceled) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"testing"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm/tikwmtest"
+)
+
+func TestDownloadLadder(t *testing.T) {
+	ladder := []tikwm.AssetType{tikwm.AssetSource, tikwm.AssetHD, tikwm.AssetSD}
+	errUnavailable := errors.New("unavailable")
+	tests := []struct {
+		name         string
+		held         tikwm.AssetType
+		fail         map[tikwm.AssetType]error // fail is the error that downloading each rung fails with, if any.
+		wantTried    []tikwm.AssetType
+		wantQuality  tikwm.AssetType // wantQuality is the quality recorded in the database.
+		wantErr      error
+		wantFallback *Fallback
+	}{
+		{
+			name:        "best rung",
+			wantTried:   []tikwm.AssetType{tikwm.AssetSource},
+			wantQuality: tikwm.AssetSource,
+		},
+		{
+			name:         "falls back to the next rung",
+			fail:         map[tikwm.AssetType]error{tikwm.AssetSource: errUnavailable},
+			wantTried:    []tikwm.AssetType{tikwm.AssetSource, tikwm.AssetHD},
+			wantQuality:  tikwm.AssetHD,
+			wantFallback: &Fallback{Wanted: tikwm.AssetSource, Got: tikwm.AssetHD},
+		},
+		{
+			name: "already has the best rung",
+			held: tikwm.AssetSource,
+		},
+		{
+			name:         "keeps the held rung",
+			held:         tikwm.AssetHD,
+			fail:         map[tikwm.AssetType]error{tikwm.AssetSource: errUnavailable},
+			wantTried:    []tikwm.AssetType{tikwm.AssetSource},
+			wantFallback: &Fallback{Wanted: tikwm.AssetSource, Got: tikwm.AssetHD},
+		},
+		{
+			name:         "no rung",
+			fail:         map[tikwm.AssetType]error{tikwm.AssetSource: errUnavailable, tikwm.AssetHD: errUnavailable, tikwm.AssetSD: errUnavailable},
+			wantTried:    ladder,
+			wantErr:      errUnavailable,
+			wantFallback: &Fallback{Wanted: tikwm.AssetSource},
+		},
+		{
+			name:      "stops when the disk is full",
+			fail:      map[tikwm.AssetType]error{tikwm.AssetSource: tikwm.ErrDiskSpace},
+			wantTried: []tikwm.AssetType{tikwm.AssetSource},
+			wantErr:   tikwm.ErrDiskSpace,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tikwmtest.NewServer()
+			defer srv.Close()
+			c, db := newTestClient(t, srv, "source>hd>sd")
+			post := &tikwm.Post{Id: "7000000000000000000", CreateTime: 1700000000}
+			post.Author.UniqueId = testUser
+			if err := db.AddOrUpdateAsset(post.ID(), testUser, post.CreateTime, tikwm.AssetCoverMedium, "cover"); err != nil {
+				t.Fatalf("AddOrUpdateAsset: %v", err)
+			}
+
+			var tried []tikwm.AssetType
+			err := c.downloadLadder(context.Background(), post, ladder, tt.held, log.New(io.Discard, "", 0), func(quality tikwm.AssetType) error {
+				tried = append(tried, quality)
+				return tt.fail[quality]
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("downloadLadder = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(tried, tt.wantTried) {
+				t.Errorf("tried %v, want %v", tried, tt.wantTried)
+			}
+
+			records, err := db.GetPostsByAuthor(testUser)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("GetPostsByAuthor = %v, %v; want the post", records, err)
+			}
+			if records[0].Quality != tt.wantQuality {
+				t.Errorf("recorded quality %q, want %q", records[0].Quality, tt.wantQuality)
+			}
+
+			fallbacks := c.TakeFallbacks()
+			switch {
+			case tt.wantFallback == nil && len(fallbacks) != 0:
+				t.Errorf("fallbacks %+v, want none", fallbacks)
+			case tt.wantFallback != nil && len(fallbacks) != 1:
+				t.Errorf("fallbacks %+v, want one", fallbacks)
+			case tt.wantFallback != nil:
+				f := fallbacks[0]
+				if f.PostID != post.ID() || f.Wanted != tt.wantFallback.Wanted || f.Got != tt.wantFallback.Got {
+					t.Errorf("fallback %+v, want %s wanted in %s and got in %q", f, post.ID(), tt.wantFallback.Wanted, tt.wantFallback.Got)
+				}
+				if !errors.Is(f.Err, errUnavailable) {
+					t.Errorf("fallback error %v, want it to wrap %v", f.Err, errUnavailable)
+				}
+			}
+		})
+	}
+}
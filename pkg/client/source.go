@@ -0,0 +1,395 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+const (
+	// sourcePollInterval is the minimum delay between two polls of the same source encode task.
+	sourcePollInterval = time.Second
+	// sourceMaxPolls is the number of polls after which a source encode task is considered timed out.
+	sourceMaxPolls = 60
+	// sourceMaxSubmits is the number of rate-limited submissions after which a source encode task fails,
+	// so that the caller can retry or fall back to another quality.
+	sourceMaxSubmits = 5
+	// sourceRateLimitBackoff is how long the scheduler pauses after being rate-limited.
+	sourceRateLimitBackoff = 2 * time.Second
+	// sourceTaskTTL is the age after which a persisted source encode task is no longer collected.
+	sourceTaskTTL = time.Hour
+)
+
+// sourceTask is a source encode task tracked by a sourceScheduler.
+type sourceTask struct {
+	videoID     string
+	taskID      string // Empty until the task has been submitted.
+	submittedAt time.Time
+	urgent      bool // A download is blocked on the task.
+	submits     int  // Rate-limited submissions so far.
+	polls       int
+	nextPoll    time.Time
+	ctxs        []context.Context // Contexts of the callers that want the task.
+	done        chan struct{}     // Closed once result or err is set.
+	result      *tikwm.SourceEncodeResult
+	err         error
+}
+
+// wanted reports whether any caller still wants the task, forgetting the callers that gave up.
+func (t *sourceTask) wanted() bool {
+	t.ctxs = slices.DeleteFunc(t.ctxs, func(ctx context.Context) bool { return ctx.Err() != nil })
+	return len(t.ctxs) > 0
+}
+
+// finished reports whether the task has a result or an error.
+func (t *sourceTask) finished() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sourceScheduler submits source encode tasks ahead of the downloads that need them and polls all
+// outstanding tasks round-robin from a single goroutine, so that every request still goes through the
+// backend's shared rate limit. Submitted tasks are persisted, if the database implements storage.SourceTaskStore,
+// so that a restart collects them instead of submitting them again.
+type sourceScheduler struct {
+	backend tikwm.Backend
+	db      storage.SourceTaskStore // Persists submitted tasks, or nil if the database does not.
+	logger  *log.Logger
+	ahead   int  // Maximum number of prefetched tasks in flight.
+	retry   bool // Resubmit tasks that are rate-limited, up to sourceMaxSubmits times, rather than failing them.
+
+	mu          sync.Mutex
+	restored    bool
+	tasks       map[string]*sourceTask // By video ID.
+	queue       []*sourceTask          // Tasks waiting to be submitted, in the order they are needed.
+	polling     []*sourceTask          // Submitted tasks that are still pending, in round-robin order.
+	running     bool
+	pausedUntil time.Time
+	wake        chan struct{}
+}
+
+// newSourceScheduler creates a scheduler that keeps up to ahead prefetched tasks in flight.
+// Unless retry is set, a task whose submission is rate-limited fails instead of being resubmitted.
+func newSourceScheduler(backend tikwm.Backend, db storage.SourceTaskStore, logger *log.Logger, ahead int, retry bool) *sourceScheduler {
+	return &sourceScheduler{
+		backend: backend,
+		db:      db,
+		logger:  logger,
+		ahead:   ahead,
+		retry:   retry,
+		tasks:   make(map[string]*sourceTask),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// prefetch queues a source encode task for a video that is about to be downloaded.
+// The task is worked on for as long as ctx is not done, or until it is released.
+func (s *sourceScheduler) prefetch(ctx context.Context, videoID string) {
+	s.want(ctx, videoID, false)
+}
+
+// release tells the scheduler that the caller that prefetched a video with ctx no longer needs it.
+func (s *sourceScheduler) release(ctx context.Context, videoID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[videoID]
+	if !ok {
+		return
+	}
+	if i := slices.Index(t.ctxs, ctx); i >= 0 {
+		t.ctxs = slices.Delete(t.ctxs, i, i+1)
+	}
+	if !t.wanted() && t.finished() {
+		delete(s.tasks, videoID)
+	}
+	s.signal()
+}
+
+// result returns the source encode result of a video, submitting a task for it first if none was prefetched.
+func (s *sourceScheduler) result(ctx context.Context, videoID string) (*tikwm.SourceEncodeResult, error) {
+	t := s.want(ctx, videoID, true)
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Results are handed out once; a caller retrying after an error gets a new task.
+	s.mu.Lock()
+	if s.tasks[videoID] == t {
+		delete(s.tasks, videoID)
+	}
+	s.signal()
+	s.mu.Unlock()
+	if s.db != nil {
+		if err := s.db.DeleteSourceTask(videoID); err != nil {
+			s.logger.Printf("Could not delete source encode task of %s: %v", videoID, err)
+		}
+	}
+	return t.result, t.err
+}
+
+// want registers ctx as wanting the task of a video, creating the task if needed, and makes sure the
+// scheduler is running. Urgent tasks are submitted before prefetched ones, regardless of the ahead limit.
+func (s *sourceScheduler) want(ctx context.Context, videoID string, urgent bool) *sourceTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restore()
+
+	t, ok := s.tasks[videoID]
+	if !ok {
+		t = &sourceTask{videoID: videoID, done: make(chan struct{})}
+		s.tasks[videoID] = t
+		s.queue = append(s.queue, t)
+	}
+	t.ctxs = append(t.ctxs, ctx)
+	if urgent && !t.urgent && t.taskID == "" {
+		t.urgent = true
+		if i := slices.Index(s.queue, t); i >= 0 {
+			s.queue = slices.Insert(slices.Delete(s.queue, i, i+1), 0, t)
+		}
+	}
+
+	if !s.running {
+		s.running = true
+		go s.run()
+	} else {
+		s.signal()
+	}
+	return t
+}
+
+// signal wakes the scheduler if it is waiting. The caller must hold s.mu.
+func (s *sourceScheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// restore loads the tasks persisted by a previous run, once. The caller must hold s.mu.
+func (s *sourceScheduler) restore() {
+	if s.restored || s.db == nil {
+		return
+	}
+	s.restored = true
+	tasks, err := s.db.GetSourceTasks()
+	if err != nil {
+		s.logger.Printf("Could not load pending source encode tasks: %v", err)
+		return
+	}
+	for _, saved := range tasks {
+		if time.Since(saved.SubmittedAt) > sourceTaskTTL {
+			if err := s.db.DeleteSourceTask(saved.VideoID); err != nil {
+				s.logger.Printf("Could not delete source encode task of %s: %v", saved.VideoID, err)
+			}
+			continue
+		}
+		t := &sourceTask{videoID: saved.VideoID, taskID: saved.TaskID, submittedAt: saved.SubmittedAt, done: make(chan struct{})}
+		if saved.Result != nil {
+			t.result = saved.Result
+			close(t.done)
+		} else {
+			s.polling = append(s.polling, t)
+		}
+		s.tasks[t.videoID] = t
+	}
+	if len(s.tasks) > 0 {
+		s.logger.Printf("Collecting %d source encode tasks from a previous run.", len(s.tasks))
+	}
+}
+
+// run submits and polls tasks until none is wanted any more.
+func (s *sourceScheduler) run() {
+	for {
+		s.mu.Lock()
+		t, submit, delay := s.next()
+		if t == nil && delay == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		var ctx context.Context
+		if t != nil {
+			ctx = t.ctxs[0]
+		}
+		s.mu.Unlock()
+
+		switch {
+		case t == nil:
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+			}
+			timer.Stop()
+		case submit:
+			s.submit(ctx, t)
+		default:
+			s.poll(ctx, t)
+		}
+	}
+}
+
+// next picks the next task to submit or poll. If there is none yet, it returns how long to wait
+// instead, or zero if there is nothing left to do. The caller must hold s.mu.
+func (s *sourceScheduler) next() (t *sourceTask, submit bool, delay time.Duration) {
+	// Tasks nobody wants any more are dropped before submission; submitted ones stay persisted.
+	s.queue = slices.DeleteFunc(s.queue, func(t *sourceTask) bool {
+		if t.wanted() {
+			return false
+		}
+		delete(s.tasks, t.videoID)
+		return true
+	})
+	pending := len(s.queue) > 0 || slices.ContainsFunc(s.polling, (*sourceTask).wanted)
+	if !pending {
+		return nil, false, 0
+	}
+
+	now := time.Now()
+	if wait := s.pausedUntil.Sub(now); wait > 0 {
+		return nil, false, wait
+	}
+	if len(s.queue) > 0 && (s.queue[0].urgent || s.inFlight() < s.ahead) {
+		t := s.queue[0]
+		s.queue = s.queue[1:]
+		return t, true, 0
+	}
+
+	delay = sourcePollInterval
+	for i, t := range s.polling {
+		if !t.wanted() {
+			continue
+		}
+		if wait := t.nextPoll.Sub(now); wait > 0 {
+			delay = min(delay, wait)
+			continue
+		}
+		// Move the task to the back so that the others get their turn first.
+		s.polling = append(slices.Delete(s.polling, i, i+1), t)
+		return t, false, 0
+	}
+	return nil, false, delay
+}
+
+// inFlight returns the number of wanted tasks that were submitted but whose results were not handed
+// out yet. The caller must hold s.mu.
+func (s *sourceScheduler) inFlight() int {
+	n := 0
+	for _, t := range s.tasks {
+		if t.taskID != "" && t.wanted() {
+			n++
+		}
+	}
+	return n
+}
+
+// submit submits a queued task.
+func (s *sourceScheduler) submit(ctx context.Context, t *sourceTask) {
+	taskID, err := s.backend.SubmitSourceEncode(ctx, t.videoID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			// The caller gave up, but another one may still want the task.
+			s.queue = slices.Insert(s.queue, 0, t)
+		case errors.Is(err, tikwm.ErrRateLimited):
+			s.backOff()
+			t.submits++
+			if !s.retry || t.submits >= sourceMaxSubmits {
+				// Let the caller count its own retries, or fall back to another quality.
+				s.finish(t, nil, fmt.Errorf("failed to submit source encode task: %w", err))
+				return
+			}
+			s.queue = slices.Insert(s.queue, 0, t)
+		default:
+			s.finish(t, nil, fmt.Errorf("failed to submit source encode task: %w", err))
+		}
+		return
+	}
+
+	t.taskID = taskID
+	t.submittedAt = time.Now()
+	t.nextPoll = t.submittedAt
+	s.polling = append(s.polling, t)
+	if s.db == nil {
+		return
+	}
+	if err := s.db.SaveSourceTask(&storage.SourceTask{VideoID: t.videoID, TaskID: t.taskID, SubmittedAt: t.submittedAt}); err != nil {
+		s.logger.Printf("Could not save source encode task of %s: %v", t.videoID, err)
+	}
+}
+
+// poll checks a submitted task once.
+func (s *sourceScheduler) poll(ctx context.Context, t *sourceTask) {
+	result, done, err := s.backend.PollSourceEncode(ctx, t.taskID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && ctx.Err() != nil {
+		return // The caller gave up; the poll does not count.
+	}
+	t.polls++
+	t.nextPoll = time.Now().Add(sourcePollInterval)
+	switch {
+	case errors.Is(err, tikwm.ErrDailyQuota) || errors.Is(err, tikwm.ErrSourceEncodeFailed):
+		s.finish(t, nil, err) // Propagate the error to be handled by the caller.
+		return
+	case errors.Is(err, tikwm.ErrRateLimited):
+		s.backOff()
+	case err == nil && done:
+		s.finish(t, result, nil)
+		return
+	}
+	// Transient errors and pending statuses are retried until the task times out.
+	if t.polls >= sourceMaxPolls {
+		s.finish(t, nil, errors.New("source encode task timed out"))
+	}
+}
+
+// backOff pauses the scheduler after it was rate-limited. With the adaptive rate limit, the limiter
+// already slows down every request, so the scheduler doesn't pause on its own. The caller must hold s.mu.
+func (s *sourceScheduler) backOff() {
+	if !tikwm.AdaptiveRateLimit {
+		s.pausedUntil = time.Now().Add(sourceRateLimitBackoff)
+	}
+}
+
+// finish records the outcome of a task and wakes its callers. The caller must hold s.mu.
+func (s *sourceScheduler) finish(t *sourceTask, result *tikwm.SourceEncodeResult, err error) {
+	t.result, t.err = result, err
+	close(t.done)
+	if i := slices.Index(s.polling, t); i >= 0 {
+		s.polling = slices.Delete(s.polling, i, i+1)
+	}
+	if !t.wanted() {
+		delete(s.tasks, t.videoID)
+	}
+	if t.taskID == "" || s.db == nil {
+		return
+	}
+	if err != nil {
+		if err := s.db.DeleteSourceTask(t.videoID); err != nil {
+			s.logger.Printf("Could not delete source encode task of %s: %v", t.videoID, err)
+		}
+		return
+	}
+	// The result is kept until it is handed out, so that it survives a restart.
+	if err := s.db.SaveSourceTask(&storage.SourceTask{VideoID: t.videoID, TaskID: t.taskID, SubmittedAt: t.submittedAt, Result: result}); err != nil {
+		s.logger.Printf("Could not save source encode result of %s: %v", t.videoID, err)
+	}
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// recordPostStats records a snapshot of the engagement stats of posts fetched from the API, so that their growth
+// can be followed over time. Failures are only logged, as the stats must not get in the way of downloads.
+func (c *Client) recordPostStats(posts []tikwm.Post) {
+	if len(posts) == 0 || c.stats == nil {
+		return
+	}
+	if err := c.stats.AddPostStats(posts, time.Now()); err != nil {
+		c.logger.Printf("Could not record stats of %d posts: %v", len(posts), err)
+	}
+}
+
+// GetUserDetail fetches the profile of a user and records a snapshot of its stats,
+// such as its follower count, so that the growth of the creator can be followed over time.
+func (c *Client) GetUserDetail(ctx context.Context, username string) (*tikwm.UserDetail, error) {
+	detail, err := c.backend.GetUserDetail(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if detail.User.UniqueId != "" && c.stats != nil {
+		if err := c.stats.AddUserStats(detail, time.Now()); err != nil {
+			c.logger.Printf("Could not record stats of user %s: %v", detail.User.UniqueId, err)
+		}
+	}
+	return detail, nil
+}
@@ -8,18 +8,35 @@ import (
 
 // Config struct holds the core, application-agnostic configuration.
 type Config struct {
-	DownloadPath    string `koanf:"download_path"`    // Path to download videos and images.
-	Quality         string `koanf:"quality"`          // Quality of the downloaded videos ("source", "hd", "sd", "all").
-	Since           string `koanf:"since"`            // Date to download content since (YYYY-MM-DD HH:MM:SS).
-	RetryOn429      bool   `koanf:"retry_on_429"`     // Retry download on 429 error.
-	DownloadCovers  bool   `koanf:"download_covers"`  // Download video cover images.
-	CoverType       string `koanf:"cover_type"`       // Type of cover to download ("cover", "origin", "dynamic").
-	DownloadAvatars bool   `koanf:"download_avatars"` // Download user profile avatars.
-	SavePostTitle   bool   `koanf:"save_post_title"`  // Save the post title to a .txt file.
-	FfmpegPath      string `koanf:"ffmpeg_path"`      // Path to the ffmpeg executable.
-	FeedCache       bool   `koanf:"feed_cache"`       // Enable caching of user feeds.
-	FeedCacheTTL    string `koanf:"feed_cache_ttl"`   // Time-to-live for feed cache (e.g., "1h", "30m").
-	BindAddress     string `koanf:"bind_address"`     // Outbound IP address or interface to bind to.
+	DownloadPath       string            `koanf:"download_path"`        // Path to download videos and images.
+	Quality            string            `koanf:"quality"`              // Quality of the downloaded videos ("source", "hd", "sd", "wm", "all", or a ladder such as "source>hd>sd").
+	Since              string            `koanf:"since"`                // Date to download content since (YYYY-MM-DD HH:MM:SS).
+	RetryOn429         bool              `koanf:"retry_on_429"`         // Retry download on 429 error.
+	DownloadCovers     bool              `koanf:"download_covers"`      // Download video cover images.
+	CoverType          string            `koanf:"cover_type"`           // Type of cover to download ("cover", "origin", "dynamic").
+	DownloadAvatars    bool              `koanf:"download_avatars"`     // Download user profile avatars.
+	DownloadMusic      bool              `koanf:"download_music"`       // Download the music (sound) used by posts.
+	SavePostTitle      bool              `koanf:"save_post_title"`      // Save the post title to a .txt file.
+	SaveComments       bool              `koanf:"save_comments"`        // Save post comments, including replies, to a .json file.
+	SavePostMetadata   bool              `koanf:"save_post_metadata"`   // Save the API payload and download details of each post to an .info.json file.
+	SourcePrefetch     int               `koanf:"source_prefetch"`      // Number of upcoming videos whose source encode is requested ahead of their download.
+	FfmpegPath         string            `koanf:"ffmpeg_path"`          // Path to the ffmpeg executable.
+	FeedCache          bool              `koanf:"feed_cache"`           // Enable caching of user feeds.
+	FeedCacheTTL       string            `koanf:"feed_cache_ttl"`       // Time-to-live for feed cache (e.g., "1h", "30m").
+	FeedOrder          string            `koanf:"feed_order"`           // Order in which feed posts are processed ("oldest", "newest").
+	PinnedTolerance    int               `koanf:"pinned_tolerance"`     // Number of posts at the head of a profile that may be older than since without ending the feed.
+	IncrementalSync    bool              `koanf:"incremental_sync"`     // Only page through feeds until already cached posts are reached.
+	SyncOverlap        int               `koanf:"sync_overlap"`         // Number of consecutive cached posts read past the first one before an incremental sync stops.
+	FullRescanInterval string            `koanf:"full_rescan_interval"` // Interval between full scans of feeds synced incrementally (e.g., "168h").
+	BindAddress        string            `koanf:"bind_address"`         // Outbound IP address or interface to bind to.
+	APIKeys            []string          `koanf:"api_keys"`             // tikwm API keys, used in turn as each one hits its daily limit.
+	DailyQuota         int               `koanf:"daily_quota"`          // API requests allowed per IP address or API key and day.
+	QuotaReserve       int               `koanf:"quota_reserve"`        // Requests left unused before rotating to the next IP address or API key.
+	RequestDelay       string            `koanf:"request_delay"`        // Minimum delay between API requests (e.g., "1250ms").
+	AdaptiveRateLimit  bool              `koanf:"adaptive_rate_limit"`  // Slow down API requests when rate-limited, then speed back up.
+	MaxRequestDelay    string            `koanf:"max_request_delay"`    // Longest delay between API requests the adaptive rate limit slows down to.
+	RequestBurst       int               `koanf:"request_burst"`        // Number of API requests that may be sent back to back after a pause.
+	EndpointDelays     map[string]string `koanf:"endpoint_delays"`      // Minimum delay between requests of each kind ("feed", "post", "source").
 }
 
 // Default returns the default core configuration.
@@ -34,17 +51,34 @@ func Default() *Config {
 	}
 
 	return &Config{
-		DownloadPath:    defaultPath,
-		Quality:         "source",
-		Since:           "1970-01-01 00:00:00",
-		RetryOn429:      false,
-		DownloadCovers:  false,
-		CoverType:       "cover",
-		DownloadAvatars: false,
-		SavePostTitle:   false,
-		FfmpegPath:      "ffmpeg",
-		FeedCache:       true,
-		FeedCacheTTL:    "1h",
-		BindAddress:     "", // Default is to let the OS decide.
+		DownloadPath:       defaultPath,
+		Quality:            "source",
+		Since:              "1970-01-01 00:00:00",
+		RetryOn429:         false,
+		DownloadCovers:     false,
+		CoverType:          "cover",
+		DownloadAvatars:    false,
+		DownloadMusic:      false,
+		SavePostTitle:      false,
+		SaveComments:       false,
+		SavePostMetadata:   false,
+		SourcePrefetch:     0,
+		FfmpegPath:         "ffmpeg",
+		FeedCache:          true,
+		FeedCacheTTL:       "1h",
+		FeedOrder:          "oldest",
+		PinnedTolerance:    3,
+		IncrementalSync:    false,
+		SyncOverlap:        3,
+		FullRescanInterval: "168h",
+		BindAddress:        "", // Default is to let the OS decide.
+		APIKeys:            []string{},
+		DailyQuota:         10000,
+		QuotaReserve:       50,
+		RequestDelay:       "1250ms",
+		AdaptiveRateLimit:  true,
+		MaxRequestDelay:    "20s",
+		RequestBurst:       1,
+		EndpointDelays:     map[string]string{},
 	}
 }
@@ -13,19 +13,20 @@ var (
 	videoIDRegex = regexp.MustCompile(`\b\d{18,}\b`)
 )
 
-// RedactingWriter is an io.Writer that redacts sensitive information before
-// writing to an underlying writer.
-type RedactingWriter struct {
-	underlying   io.Writer                 // The underlying writer to write to.
+// Redactor replaces sensitive information in text with placeholders.
+type Redactor struct {
 	replacements map[*regexp.Regexp]string // Map of regex patterns to their replacements.
 }
 
-// NewRedactingWriter creates a new writer that redacts specified patterns.
-func NewRedactingWriter(w io.Writer, downloadPath string, targets []string) io.Writer {
+// NewRedactor creates a redactor for the download path and the usernames of targets.
+// If redactIDs is true, video IDs are redacted as well.
+func NewRedactor(downloadPath string, targets []string, redactIDs bool) *Redactor {
 	replacements := make(map[*regexp.Regexp]string)
 
 	// Add static redactions
-	replacements[videoIDRegex] = "[VIDEO_ID]"
+	if redactIDs {
+		replacements[videoIDRegex] = "[VIDEO_ID]"
+	}
 
 	// Add dynamic redactions
 	if downloadPath != "" {
@@ -41,20 +42,36 @@ func NewRedactingWriter(w io.Writer, downloadPath string, targets []string) io.W
 		}
 	}
 
+	return &Redactor{replacements: replacements}
+}
+
+// Redact returns message with all sensitive information replaced.
+func (r *Redactor) Redact(message string) string {
+	for re, repl := range r.replacements {
+		message = re.ReplaceAllString(message, repl) // Replace all occurrences of the pattern with the replacement string.
+	}
+	return message
+}
+
+// RedactingWriter is an io.Writer that redacts sensitive information before
+// writing to an underlying writer.
+type RedactingWriter struct {
+	underlying io.Writer // The underlying writer to write to.
+	redactor   *Redactor // The redactor applied to everything written.
+}
+
+// NewRedactingWriter creates a new writer that redacts video IDs, the download path and the usernames of targets.
+func NewRedactingWriter(w io.Writer, downloadPath string, targets []string) io.Writer {
 	return &RedactingWriter{
-		underlying:   w,
-		replacements: replacements,
+		underlying: w,
+		redactor:   NewRedactor(downloadPath, targets, true),
 	}
 }
 
 // Write redacts the input byte slice and writes it to the underlying writer.
 func (rw *RedactingWriter) Write(p []byte) (n int, err error) {
-	originalLen := len(p) // Store the original length of the input.
-	message := string(p)  // Convert the byte slice to a string.
-	for re, repl := range rw.replacements {
-		message = re.ReplaceAllString(message, repl) // Replace all occurrences of the pattern with the replacement string.
-	}
-
+	originalLen := len(p)                         // Store the original length of the input.
+	message := rw.redactor.Redact(string(p))      // Redact the message.
 	_, err = rw.underlying.Write([]byte(message)) // Write the redacted message to the underlying writer.
 	if err != nil {
 		return 0, err
@@ -99,20 +99,48 @@ func (r *IPRotator) GetNextAvailableAddress() (*net.TCPAddr, error) {
 
 // MarkCurrentAddressAsExhausted flags the most recently used IP as rate-limited.
 func (r *IPRotator) MarkCurrentAddressAsExhausted() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if current := r.currentAddress(); current != "" {
+		r.markExhausted(current, time.Now())
+	}
+}
+
+// currentAddress returns the IP of the most recently used address, or an empty string if none was used yet.
+func (r *IPRotator) currentAddress() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	if r.lastUsed == nil {
-		return
+		return ""
 	}
+	return r.lastUsed.IP.String()
+}
+
+// markExhausted flags the address with the given IP as rate-limited since at, and reports whether it was
+// not flagged already.
+func (r *IPRotator) markExhausted(ip string, at time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
 	for _, state := range r.addresses {
-		if state.address.addr.String() == r.lastUsed.String() {
+		if state.address.addr.IP.String() == ip && !state.isExhausted {
 			state.isExhausted = true
-			state.exhaustedAt = time.Now()
-			break
+			state.exhaustedAt = at
+			return true
 		}
 	}
+	return false
+}
+
+// addressList returns the IPs of the rotator's addresses, in rotation order.
+func (r *IPRotator) addressList() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ips := make([]string, len(r.addresses))
+	for i, state := range r.addresses {
+		ips[i] = state.address.addr.IP.String()
+	}
+	return ips
 }
 
 // resolveBindAddr takes a string that can be an IP address or an interface name
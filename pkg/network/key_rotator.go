@@ -0,0 +1,115 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyState tracks the status of a configured API key.
+type keyState struct {
+	key         string
+	isExhausted bool
+	exhaustedAt time.Time
+}
+
+// KeyRotator manages a pool of API keys. The current key is used until it hits its daily limit,
+// after which requests move on to the next key that is not exhausted.
+type KeyRotator struct {
+	mu            sync.Mutex
+	keys          []*keyState
+	currentIndex  int
+	exhaustionTTL time.Duration
+}
+
+// NewKeyRotator creates a KeyRotator for the given keys. Empty and duplicate keys are ignored.
+func NewKeyRotator(keys []string, exhaustionTTL time.Duration) (*KeyRotator, error) {
+	rotator := &KeyRotator{exhaustionTTL: exhaustionTTL}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		rotator.keys = append(rotator.keys, &keyState{key: key})
+	}
+	if len(rotator.keys) == 0 {
+		return nil, fmt.Errorf("no API keys provided")
+	}
+	return rotator, nil
+}
+
+// NextKey returns the key to send the next request with. Requests are counted against the key by CountRequest.
+func (r *KeyRotator) NextKey() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Un-exhaust any keys whose TTL has expired.
+	for _, state := range r.keys {
+		if state.isExhausted && time.Since(state.exhaustedAt) > r.exhaustionTTL {
+			state.isExhausted = false
+		}
+	}
+
+	// Starting from the current key, find the first one that is available.
+	for i := 0; i < len(r.keys); i++ {
+		idx := (r.currentIndex + i) % len(r.keys)
+		if state := r.keys[idx]; !state.isExhausted {
+			r.currentIndex = idx
+			return state.key, nil
+		}
+	}
+	return "", fmt.Errorf("all %d API keys have reached their daily limit", len(r.keys))
+}
+
+// MarkKeyAsExhausted flags key as having hit its daily limit. Requests sent with the key before it was
+// flagged may report the limit too, so the key is named explicitly rather than taken to be the current one.
+func (r *KeyRotator) MarkKeyAsExhausted(key string) {
+	r.markExhausted(key, time.Now())
+}
+
+// markExhausted flags key as having hit its daily limit at the given time, and reports whether it was not
+// flagged already.
+func (r *KeyRotator) markExhausted(key string, at time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, state := range r.keys {
+		if state.key == key && !state.isExhausted {
+			state.isExhausted = true
+			state.exhaustedAt = at
+			return true
+		}
+	}
+	return false
+}
+
+// keyList returns the keys of the rotator, in rotation order.
+func (r *KeyRotator) keyList() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, len(r.keys))
+	for i, state := range r.keys {
+		keys[i] = state.key
+	}
+	return keys
+}
+
+// MaskKey returns a form of key that is safe to log, keeping only its last four characters.
+func MaskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
+
+// KeyIdentity returns the identity that requests sent with key are counted against in the quota table. Like MaskKey,
+// it is safe to log, but it starts with a short hash of the whole key, so that keys ending alike are told apart.
+func KeyIdentity(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4]) + MaskKey(key)
+}
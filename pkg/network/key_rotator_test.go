@@ -0,0 +1,94 @@
+package network
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextKey returns the key the rotator hands out next, failing the test on error.
+func nextKey(t *testing.T, r *KeyRotator) string {
+	t.Helper()
+	key, err := r.NextKey()
+	if err != nil {
+		t.Fatalf("NextKey: %v", err)
+	}
+	return key
+}
+
+func TestNewKeyRotator(t *testing.T) {
+	r, err := NewKeyRotator([]string{" key-one ", "", "key-two", "key-one"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyRotator: %v", err)
+	}
+	if got, want := r.keyList(), []string{"key-one", "key-two"}; !slices.Equal(got, want) {
+		t.Errorf("keys %v, want %v", got, want)
+	}
+	if _, err := NewKeyRotator([]string{" ", ""}, time.Hour); err == nil {
+		t.Errorf("NewKeyRotator without keys succeeded")
+	}
+}
+
+func TestKeyRotatorRotation(t *testing.T) {
+	r, err := NewKeyRotator([]string{"key-one", "key-two", "key-three"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyRotator: %v", err)
+	}
+	if key := nextKey(t, r); key != "key-one" {
+		t.Fatalf("first key %q, want key-one", key)
+	}
+	if key := nextKey(t, r); key != "key-one" {
+		t.Fatalf("key changed to %q before key-one was exhausted", key)
+	}
+
+	r.MarkKeyAsExhausted("key-one")
+	if key := nextKey(t, r); key != "key-two" {
+		t.Fatalf("key after key-one was exhausted %q, want key-two", key)
+	}
+	// A late limit response for a key that was already rotated away from does not move the current key.
+	r.MarkKeyAsExhausted("key-one")
+	r.MarkKeyAsExhausted("key-three")
+	if key := nextKey(t, r); key != "key-two" {
+		t.Fatalf("key after key-three was exhausted %q, want key-two", key)
+	}
+
+	r.MarkKeyAsExhausted("key-two")
+	if _, err := r.NextKey(); err == nil {
+		t.Fatalf("NextKey succeeded with every key exhausted")
+	}
+}
+
+func TestKeyRotatorExhaustionExpires(t *testing.T) {
+	r, err := NewKeyRotator([]string{"key-one", "key-two"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyRotator: %v", err)
+	}
+	r.markExhausted("key-one", time.Now().Add(-2*time.Hour))
+	r.markExhausted("key-two", time.Now())
+	if key := nextKey(t, r); key != "key-one" {
+		t.Fatalf("key %q, want key-one once its exhaustion expired", key)
+	}
+	if r.markExhausted("key-two", time.Now()) {
+		t.Errorf("markExhausted reported key-two as newly exhausted twice")
+	}
+}
+
+func TestKeyIdentity(t *testing.T) {
+	// The keys end alike, so they have the same mask.
+	a, b := KeyIdentity("first-secret-1234"), KeyIdentity("other-secret-1234")
+	if a == b {
+		t.Errorf("keys ending alike have the same identity %q", a)
+	}
+	for _, identity := range []string{a, b} {
+		if !strings.HasSuffix(identity, MaskKey("first-secret-1234")) {
+			t.Errorf("identity %q does not end with the masked key", identity)
+		}
+		if strings.Contains(identity, "secret") {
+			t.Errorf("identity %q reveals the key", identity)
+		}
+	}
+	if KeyIdentity("first-secret-1234") != a {
+		t.Errorf("KeyIdentity is not stable")
+	}
+}
@@ -11,6 +11,10 @@ import (
 var (
 	// globalRotator is the instance that manages IP addresses.
 	globalRotator *IPRotator
+	// globalKeys is the instance that manages API keys, or nil if requests are anonymous.
+	globalKeys *KeyRotator
+	// rotatingTransport is the transport dialing from the rotator's addresses, or nil without bind addresses.
+	rotatingTransport *http.Transport
 )
 
 // InitManager initializes the global network manager with IP rotation capabilities.
@@ -23,7 +27,7 @@ func InitManager(bindAddresses string) error {
 
 	var err error
 	// The per-IP daily limit is 24 hours.
-	globalRotator, err = NewIPRotator(bindAddresses, 24*time.Hour)
+	globalRotator, err = NewIPRotator(bindAddresses, QuotaResetAfter)
 	if err != nil {
 		return err
 	}
@@ -51,13 +55,80 @@ func InitManager(bindAddresses string) error {
 	}
 
 	// Set the custom transport as the default for all HTTP clients.
+	rotatingTransport = transport
 	http.DefaultClient = &http.Client{Transport: transport}
 	return nil
 }
 
 // MarkCurrentAddressAsExhausted signals the global rotator to mark the last-used IP as exhausted.
 func MarkCurrentAddressAsExhausted() {
+	if globalRotator == nil {
+		return
+	}
+	current := globalRotator.currentAddress()
+	if current == "" {
+		return
+	}
+	now := time.Now()
+	if globalRotator.markExhausted(current, now) {
+		closeIdleConnections()
+		persistExhausted(current, now)
+	}
+}
+
+// closeIdleConnections closes the kept-alive connections of the rotating transport, so that requests stop
+// reusing connections from addresses that were marked as exhausted.
+func closeIdleConnections() {
+	if rotatingTransport != nil {
+		rotatingTransport.CloseIdleConnections()
+	}
+}
+
+// InitKeys sets the API keys attached to API requests. With no keys, requests are anonymous.
+func InitKeys(keys []string) error {
+	globalKeys = nil
+	if len(keys) == 0 {
+		return nil
+	}
+	var err error
+	// The per-key daily limit is 24 hours.
+	globalKeys, err = NewKeyRotator(keys, QuotaResetAfter)
+	return err
+}
+
+// UsingAPIKeys reports whether API requests are sent with API keys.
+func UsingAPIKeys() bool {
+	return globalKeys != nil
+}
+
+// NextAPIKey returns the API key to send the next request with, or an empty string if requests are anonymous.
+func NextAPIKey() (string, error) {
+	if globalKeys == nil {
+		return "", nil
+	}
+	return globalKeys.NextKey()
+}
+
+// MarkAPIKeyAsExhausted signals the global key rotator that key hit its daily limit.
+func MarkAPIKeyAsExhausted(key string) {
+	now := time.Now()
+	if globalKeys != nil && globalKeys.markExhausted(key, now) {
+		persistExhausted(KeyIdentity(key), now)
+	}
+}
+
+// RotateOnDailyQuota moves away from whatever hit the API's daily limit. API keys are rotated as soon as
+// a request reports that its key hit the limit, so without keys the current IP address is marked as
+// exhausted instead. Without bind addresses either, there is nothing to rotate to, and CheckQuota fails
+// until the limit resets. It returns what was rotated, "API key" or "IP", for log messages.
+func RotateOnDailyQuota() string {
+	if UsingAPIKeys() {
+		return "API key"
+	}
 	if globalRotator != nil {
-		globalRotator.MarkCurrentAddressAsExhausted()
+		MarkCurrentAddressAsExhausted()
+	} else if now := time.Now(); markExhausted(DefaultIdentity, now) {
+		persistExhausted(DefaultIdentity, now)
 	}
+	return "IP"
 }
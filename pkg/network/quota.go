@@ -0,0 +1,196 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultIdentity is the identity that requests sent without an API key or bind address are counted against.
+const DefaultIdentity = "default"
+
+// QuotaResetAfter is how long an IP address or API key stays exhausted after hitting the daily limit.
+const QuotaResetAfter = 24 * time.Hour
+
+// ErrQuotaExhausted is returned for requests that cannot be sent because the daily limit has been reached.
+var ErrQuotaExhausted = errors.New("daily quota exhausted")
+
+// QuotaUsage is the number of API requests counted against an identity (a bind address, the KeyIdentity of an
+// API key, or DefaultIdentity) on one day.
+type QuotaUsage struct {
+	Identity    string    // Identity is what the requests were counted against.
+	Day         string    // Day is the UTC date of the requests, as returned by QuotaDay.
+	Requests    int       // Requests is the number of requests sent that day.
+	ExhaustedAt time.Time // ExhaustedAt is when the identity hit the daily limit that day, or zero.
+}
+
+// QuotaStore persists quota usage, so that it is shared between processes and survives restarts.
+type QuotaStore interface {
+	// AddQuotaRequest counts one request against identity on day and returns the day's count.
+	AddQuotaRequest(identity, day string) (int, error)
+	// SetQuotaExhausted records that identity hit the daily limit at the given time, unless it already did that day.
+	SetQuotaExhausted(identity, day string, at time.Time) error
+	// GetQuotaUsage retrieves the usage of every identity from day on, ordered by day.
+	GetQuotaUsage(since string) ([]QuotaUsage, error)
+}
+
+var (
+	// OnQuotaReserveReached, if set, is called when an identity is rotated away from because its requests
+	// today have reached the daily quota minus the reserve.
+	OnQuotaReserveReached func(identity string, requests int)
+
+	quotaMu            sync.Mutex
+	quotaStore         QuotaStore
+	quotaLimit         int       // Requests allowed per identity and day, or 0 if unknown.
+	quotaReserve       int       // Requests left unused before rotating away from an identity.
+	defaultExhaustedAt time.Time // When DefaultIdentity last hit the daily limit.
+)
+
+// QuotaDay returns the day that requests sent at t are counted on.
+func QuotaDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// InitQuota starts counting API requests in store, and restores the IP addresses and API keys that are still
+// exhausted. Once an address or key has sent limit-reserve requests in a day, requests move on to the next one
+// before the limit is hit. A limit of 0 disables rotating ahead of the limit.
+// It must be called after InitManager and InitKeys.
+func InitQuota(store QuotaStore, limit, reserve int) error {
+	usage, err := store.GetQuotaUsage(QuotaDay(time.Now().Add(-QuotaResetAfter)))
+	if err != nil {
+		return fmt.Errorf("failed to load API quota usage: %w", err)
+	}
+	quotaMu.Lock()
+	quotaStore, quotaLimit, quotaReserve = store, limit, max(reserve, 0)
+	defaultExhaustedAt = time.Time{}
+	quotaMu.Unlock()
+	for _, u := range usage {
+		if !u.ExhaustedAt.IsZero() && time.Since(u.ExhaustedAt) < QuotaResetAfter {
+			markExhausted(u.Identity, u.ExhaustedAt)
+		}
+	}
+	return nil
+}
+
+// QuotaLimit returns the number of requests allowed per identity and day, as set by InitQuota.
+func QuotaLimit() int {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	return quotaLimit
+}
+
+// QuotaIdentities returns the identities that requests are currently counted against: the KeyIdentity of each
+// API key, or else the bind addresses, or else DefaultIdentity.
+func QuotaIdentities() []string {
+	switch {
+	case globalKeys != nil:
+		keys := globalKeys.keyList()
+		identities := make([]string, len(keys))
+		for i, key := range keys {
+			identities[i] = KeyIdentity(key)
+		}
+		return identities
+	case globalRotator != nil:
+		return globalRotator.addressList()
+	default:
+		return []string{DefaultIdentity}
+	}
+}
+
+// CheckQuota returns ErrQuotaExhausted if requests without an API key or bind address have hit the daily limit.
+// API keys and bind addresses are skipped by their rotators once exhausted instead.
+func CheckQuota() error {
+	if globalKeys != nil || globalRotator != nil {
+		return nil
+	}
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	if !defaultExhaustedAt.IsZero() && time.Since(defaultExhaustedAt) < QuotaResetAfter {
+		return fmt.Errorf("%w until %s", ErrQuotaExhausted, defaultExhaustedAt.Add(QuotaResetAfter).Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// CountRequest counts a request sent with key, if any, from the local address local against the daily quota.
+// If the request brings an API key or bind address within the reserve of the limit, it is marked as exhausted,
+// so that the next requests use another one.
+func CountRequest(key string, local net.Addr) {
+	quotaMu.Lock()
+	store, limit, reserve := quotaStore, quotaLimit, quotaReserve
+	quotaMu.Unlock()
+	if store == nil {
+		return
+	}
+	identity := requestIdentity(key, local)
+	now := time.Now()
+	requests, err := store.AddQuotaRequest(identity, QuotaDay(now))
+	if err != nil {
+		log.Printf("Failed to count API request against the daily quota of %s: %v", identity, err)
+		return
+	}
+	// Without API keys or bind addresses there is nothing to rotate to, so the reserve would only be wasted.
+	if limit <= 0 || identity == DefaultIdentity || requests < limit-reserve {
+		return
+	}
+	if markExhausted(identity, now) {
+		persistExhausted(identity, now)
+		if OnQuotaReserveReached != nil {
+			OnQuotaReserveReached(identity, requests)
+		}
+	}
+}
+
+// requestIdentity returns the identity that a request sent with key from local is counted against.
+func requestIdentity(key string, local net.Addr) string {
+	if key != "" {
+		return KeyIdentity(key)
+	}
+	if globalRotator != nil {
+		if addr, ok := local.(*net.TCPAddr); ok {
+			return addr.IP.String()
+		}
+	}
+	return DefaultIdentity
+}
+
+// markExhausted marks identity as exhausted since at, and reports whether it was not exhausted already.
+func markExhausted(identity string, at time.Time) bool {
+	switch {
+	case globalKeys != nil:
+		for _, key := range globalKeys.keyList() {
+			if KeyIdentity(key) == identity {
+				return globalKeys.markExhausted(key, at)
+			}
+		}
+	case globalRotator != nil:
+		if globalRotator.markExhausted(identity, at) {
+			closeIdleConnections()
+			return true
+		}
+	case identity == DefaultIdentity:
+		quotaMu.Lock()
+		defer quotaMu.Unlock()
+		if !defaultExhaustedAt.IsZero() && time.Since(defaultExhaustedAt) < QuotaResetAfter {
+			return false
+		}
+		defaultExhaustedAt = at
+		return true
+	}
+	return false
+}
+
+// persistExhausted records in the quota store that identity hit the daily limit at the given time.
+func persistExhausted(identity string, at time.Time) {
+	quotaMu.Lock()
+	store := quotaStore
+	quotaMu.Unlock()
+	if store == nil {
+		return
+	}
+	if err := store.SetQuotaExhausted(identity, QuotaDay(at), at); err != nil {
+		log.Printf("Failed to save the daily quota exhaustion of %s: %v", identity, err)
+	}
+}
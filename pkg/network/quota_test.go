@@ -0,0 +1,126 @@
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// memQuotaStore is a QuotaStore kept in memory.
+type memQuotaStore struct {
+	mu        sync.Mutex
+	requests  map[[2]string]int
+	exhausted map[[2]string]time.Time
+}
+
+func newMemQuotaStore() *memQuotaStore {
+	return &memQuotaStore{requests: make(map[[2]string]int), exhausted: make(map[[2]string]time.Time)}
+}
+
+func (s *memQuotaStore) AddQuotaRequest(identity, day string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[[2]string{identity, day}]++
+	return s.requests[[2]string{identity, day}], nil
+}
+
+func (s *memQuotaStore) SetQuotaExhausted(identity, day string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.exhausted[[2]string{identity, day}]; !ok {
+		s.exhausted[[2]string{identity, day}] = at
+	}
+	return nil
+}
+
+func (s *memQuotaStore) GetQuotaUsage(since string) ([]QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var usage []QuotaUsage
+	for k, at := range s.exhausted {
+		if k[1] >= since {
+			usage = append(usage, QuotaUsage{Identity: k[0], Day: k[1], Requests: s.requests[k], ExhaustedAt: at})
+		}
+	}
+	return usage, nil
+}
+
+// initTestQuota sets up the global API keys and quota counting, and resets them at the end of the test.
+func initTestQuota(t *testing.T, keys []string, store QuotaStore, limit, reserve int) {
+	t.Helper()
+	t.Cleanup(func() {
+		_ = InitKeys(nil)
+		quotaMu.Lock()
+		quotaStore, quotaLimit, quotaReserve = nil, 0, 0
+		defaultExhaustedAt = time.Time{}
+		quotaMu.Unlock()
+		OnQuotaReserveReached = nil
+	})
+	if err := InitKeys(keys); err != nil {
+		t.Fatalf("InitKeys: %v", err)
+	}
+	if err := InitQuota(store, limit, reserve); err != nil {
+		t.Fatalf("InitQuota: %v", err)
+	}
+}
+
+func TestCountRequestRotatesWithinReserve(t *testing.T) {
+	store := newMemQuotaStore()
+	initTestQuota(t, []string{"key-one", "key-two"}, store, 10, 3)
+	var reached []string
+	OnQuotaReserveReached = func(identity string, requests int) {
+		reached = append(reached, identity)
+	}
+
+	for i := 1; i <= 7; i++ {
+		key, err := NextAPIKey()
+		if err != nil {
+			t.Fatalf("NextAPIKey before request %d: %v", i, err)
+		}
+		if key != "key-one" {
+			t.Fatalf("request %d uses %q, want key-one until it is within the reserve", i, key)
+		}
+		CountRequest(key, nil)
+	}
+	if key, err := NextAPIKey(); err != nil || key != "key-two" {
+		t.Fatalf("NextAPIKey = %q, %v, want key-two once key-one is within the reserve", key, err)
+	}
+	// Requests already sent with key-one still count, but do not report it again.
+	CountRequest("key-one", nil)
+
+	identity := KeyIdentity("key-one")
+	if len(reached) != 1 || reached[0] != identity {
+		t.Errorf("reserve reached for %v, want once for %s", reached, identity)
+	}
+	if _, ok := store.exhausted[[2]string{identity, QuotaDay(time.Now())}]; !ok {
+		t.Errorf("exhaustion of key-one not saved in the quota store")
+	}
+}
+
+func TestCountRequestKeepsDefaultIdentity(t *testing.T) {
+	store := newMemQuotaStore()
+	initTestQuota(t, nil, store, 10, 3)
+	for range 9 {
+		CountRequest("", nil)
+	}
+	if err := CheckQuota(); err != nil {
+		t.Errorf("CheckQuota = %v within the reserve, want nil as there is nothing to rotate to", err)
+	}
+	if n := store.requests[[2]string{DefaultIdentity, QuotaDay(time.Now())}]; n != 9 {
+		t.Errorf("counted %d requests against %s, want 9", n, DefaultIdentity)
+	}
+	if len(store.exhausted) != 0 {
+		t.Errorf("saved exhaustions %v, want none", store.exhausted)
+	}
+}
+
+func TestInitQuotaRestoresExhaustedKeys(t *testing.T) {
+	store := newMemQuotaStore()
+	now := time.Now()
+	store.exhausted[[2]string{KeyIdentity("key-one"), QuotaDay(now)}] = now.Add(-time.Hour)
+	initTestQuota(t, []string{"key-one", "key-two"}, store, 10, 3)
+
+	if key, err := NextAPIKey(); err != nil || key != "key-two" {
+		t.Errorf("NextAPIKey = %q, %v, want key-two as key-one is still exhausted", key, err)
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// adaptiveRecoverAfter is the number of consecutive successful operations after which Adaptive speeds up.
+const adaptiveRecoverAfter = 10
+
+// Adaptive tunes the interval of a Group from the outcome of the operations it limits: the interval is
+// doubled whenever operations are throttled, and brought back toward its base by a quarter after every
+// run of successful operations. All callers of the group therefore back off together.
+type Adaptive struct {
+	group    *Group
+	base     time.Duration
+	max      time.Duration
+	onChange func(previous, interval time.Duration)
+
+	mu        sync.Mutex
+	interval  time.Duration
+	successes int       // Consecutive successful operations.
+	slowedAt  time.Time // When the interval was last increased.
+}
+
+// NewAdaptive creates an Adaptive for a group whose interval is base, never slowing it down past max.
+// If onChange is not nil, it is called with the previous and the new interval whenever the interval changes;
+// it must not call back into the Adaptive.
+func NewAdaptive(group *Group, base, max time.Duration, onChange func(previous, interval time.Duration)) *Adaptive {
+	return &Adaptive{group: group, base: base, max: max, onChange: onChange, interval: base}
+}
+
+// Interval returns the current interval.
+func (a *Adaptive) Interval() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.interval
+}
+
+// Throttled reports an operation that was rejected for exceeding the rate limit.
+// Operations throttled within one interval of the last slowdown were already in flight when it
+// happened, so they don't slow the group down further.
+func (a *Adaptive) Throttled() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.successes = 0
+	if time.Since(a.slowedAt) < a.interval {
+		return
+	}
+	a.slowedAt = time.Now()
+	a.set(min(a.max, 2*a.interval))
+}
+
+// Success reports an operation that was not throttled.
+func (a *Adaptive) Success() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.successes++
+	if a.successes < adaptiveRecoverAfter || a.interval <= a.base {
+		return
+	}
+	a.successes = 0
+	a.set(max(a.base, a.interval-a.interval/4))
+}
+
+// set applies a new interval. The caller must hold a.mu.
+func (a *Adaptive) set(interval time.Duration) {
+	if interval == a.interval {
+		return
+	}
+	previous := a.interval
+	a.interval = interval
+	a.group.SetInterval(interval)
+	if a.onChange != nil {
+		a.onChange(previous, interval)
+	}
+}
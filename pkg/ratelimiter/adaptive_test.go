@@ -0,0 +1,78 @@
+package ratelimiter
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAdaptive(t *testing.T) {
+	const base, maxInterval = 100 * time.Millisecond, time.Second
+	group := NewGroup(New(base, 1))
+	defer group.Stop()
+	var changes []time.Duration
+	a := NewAdaptive(group, base, maxInterval, func(previous, interval time.Duration) {
+		changes = append(changes, interval)
+	})
+	// check fails the test unless both a and the group's limiter use interval.
+	check := func(step string, interval time.Duration) {
+		t.Helper()
+		if got := a.Interval(); got != interval {
+			t.Fatalf("%s: interval %v, want %v", step, got, interval)
+		}
+		group.global.mu.Lock()
+		got := group.global.interval
+		group.global.mu.Unlock()
+		if got != interval {
+			t.Fatalf("%s: group interval %v, want %v", step, got, interval)
+		}
+	}
+	// later pretends that the last slowdown happened more than an interval ago.
+	later := func() {
+		a.mu.Lock()
+		a.slowedAt = time.Time{}
+		a.mu.Unlock()
+	}
+
+	a.Success()
+	check("success at the base interval", base)
+
+	a.Throttled()
+	check("throttled", 200*time.Millisecond)
+	a.Throttled()
+	check("throttled again within the interval", 200*time.Millisecond)
+
+	later()
+	a.Throttled()
+	check("throttled after the interval", 400*time.Millisecond)
+	for range 3 {
+		later()
+		a.Throttled()
+	}
+	check("throttled up to the maximum", maxInterval)
+
+	for range adaptiveRecoverAfter - 1 {
+		a.Success()
+	}
+	check("not enough successes", maxInterval)
+	a.Throttled() // Within the interval, so it only resets the run of successes.
+	a.Success()
+	check("run of successes broken", maxInterval)
+	for range adaptiveRecoverAfter - 1 {
+		a.Success()
+	}
+	check("run of successes", 750*time.Millisecond)
+
+	for range 20 * adaptiveRecoverAfter {
+		a.Success()
+	}
+	check("recovered", base)
+
+	want := []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, maxInterval, 750 * time.Millisecond}
+	if !slices.Equal(changes[:len(want)], want) {
+		t.Errorf("changes %v, want them to start with %v", changes, want)
+	}
+	if last := changes[len(changes)-1]; last != base {
+		t.Errorf("last change to %v, want %v", last, base)
+	}
+}
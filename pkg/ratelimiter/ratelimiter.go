@@ -2,52 +2,239 @@ package ratelimiter
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 )
 
-// RateLimiter enforces a strict rate limit on operations.
+// ErrStopped is returned by Wait once the limiter has been stopped.
+var ErrStopped = errors.New("rate limiter stopped")
+
+// RateLimiter is a token-bucket rate limiter. A token is added every interval, up to burst tokens,
+// and every Wait takes one. Waiters are served in the order they arrived.
 type RateLimiter struct {
-	ticker  *time.Ticker
-	ctx     context.Context
-	first   chan struct{} // Channel to signal the first request, allowing it to pass immediately.
-	stopped bool
+	interval time.Duration
+	burst    int
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time // When tokens was last refilled.
+	queue   []*waiter // Waiters in arrival order.
+	timer   *time.Timer
+	stopped chan struct{}
+}
+
+// waiter is a caller blocked in Wait.
+type waiter struct {
+	ready chan struct{} // Closed once a token has been handed to the waiter.
 }
 
-// New creates a new RateLimiter.
-func New(rate time.Duration, ctx context.Context) *RateLimiter {
-	rl := &RateLimiter{
-		ticker: time.NewTicker(rate),
-		ctx:    ctx,
-		first:  make(chan struct{}, 1),
+// New creates a RateLimiter that allows one operation per interval, with bursts of up to burst operations.
+// The bucket starts full, so the first burst operations pass immediately.
+func New(interval time.Duration, burst int) *RateLimiter {
+	burst = max(burst, 1)
+	return &RateLimiter{
+		interval: interval,
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+		stopped:  make(chan struct{}),
 	}
-	// Pre-fill the channel so the first Wait() call returns immediately.
-	rl.first <- struct{}{}
-	return rl
 }
 
-// Wait blocks until the next token is available from the ticker, or until the context is done.
-func (r *RateLimiter) Wait() error {
-	// The first request will consume from the pre-filled `first` channel and return instantly.
-	// Subsequent requests will find the channel empty and block on the ticker.
+// Wait blocks until a token is available, ctx is done or the limiter is stopped.
+// A caller whose ctx is done gives up its place in the queue without using a token.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
 	select {
-	case <-r.first:
-		return nil
+	case <-r.stopped:
+		r.mu.Unlock()
+		return ErrStopped
 	default:
 	}
+	r.refill()
+	if len(r.queue) == 0 && r.tokens >= 1 {
+		r.tokens--
+		r.mu.Unlock()
+		return nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	r.queue = append(r.queue, w)
+	r.dispatch()
+	r.mu.Unlock()
 
 	select {
-	case <-r.ticker.C:
+	case <-w.ready:
 		return nil
-	case <-r.ctx.Done():
-		r.stopped = true
-		return r.ctx.Err()
+	case <-r.stopped:
+		return ErrStopped
+	case <-ctx.Done():
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		select {
+		case <-w.ready:
+			// The token was handed over while giving up, so hand it on.
+			r.tokens++
+		default:
+			for i, queued := range r.queue {
+				if queued == w {
+					r.queue = append(r.queue[:i], r.queue[i+1:]...)
+					break
+				}
+			}
+		}
+		r.dispatch()
+		return ctx.Err()
 	}
 }
 
-// Stop releases resources used by the RateLimiter.
+// Stop releases the limiter's timer and makes all pending and future Wait calls return ErrStopped.
 func (r *RateLimiter) Stop() {
-	if !r.stopped {
-		r.ticker.Stop()
-		r.stopped = true
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.stopped:
+		return
+	default:
+	}
+	close(r.stopped)
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.queue = nil
+}
+
+// SetInterval changes the time it takes to earn a token. Tokens already earned are kept.
+func (r *RateLimiter) SetInterval(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refill()
+	r.interval = interval
+	if r.timer != nil {
+		// Re-arm the timer for the new interval.
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.dispatch()
+}
+
+// refill adds the tokens earned since the last refill. The caller must hold r.mu.
+func (r *RateLimiter) refill() {
+	now := time.Now()
+	if r.interval <= 0 {
+		r.tokens = float64(r.burst)
+	} else {
+		r.tokens = min(float64(r.burst), r.tokens+float64(now.Sub(r.last))/float64(r.interval))
+	}
+	r.last = now
+}
+
+// dispatch hands available tokens to queued waiters in order, and arms the timer for the next token
+// if any waiter is left. The caller must hold r.mu.
+func (r *RateLimiter) dispatch() {
+	r.refill()
+	for len(r.queue) > 0 && r.tokens >= 1 {
+		r.tokens--
+		close(r.queue[0].ready)
+		r.queue = r.queue[1:]
+	}
+	if len(r.queue) == 0 || r.timer != nil {
+		return
+	}
+	wait := time.Duration((1 - r.tokens) * float64(r.interval))
+	r.timer = time.AfterFunc(wait, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		select {
+		case <-r.stopped:
+			return
+		default:
+		}
+		r.timer = nil
+		r.dispatch()
+	})
+}
+
+// Group combines a global limiter with per-key budgets, such as one per kind of API endpoint.
+// Every Wait takes a token from the key's own limiter, if it has one, then from the global limiter,
+// and then from the budget shared with other processes, if any.
+type Group struct {
+	global *RateLimiter
+
+	mu     sync.Mutex
+	keys   map[string]*RateLimiter
+	shared *Shared
+}
+
+// NewGroup creates a Group whose operations are all limited by global.
+func NewGroup(global *RateLimiter) *Group {
+	return &Group{global: global, keys: make(map[string]*RateLimiter)}
+}
+
+// SetLimit gives key its own budget of one operation per interval, with bursts of up to burst operations.
+func (g *Group) SetLimit(key string, interval time.Duration, burst int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if old, ok := g.keys[key]; ok {
+		old.Stop()
+	}
+	g.keys[key] = New(interval, burst)
+}
+
+// Share makes the group also wait for shared, a budget shared with other processes.
+// The group takes ownership of shared and stops it when the group is stopped.
+func (g *Group) Share(shared *Shared) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.shared != nil {
+		g.shared.Stop()
+	}
+	g.shared = shared
+}
+
+// SetInterval changes the interval of the global limiter and of the shared budget. Per-key budgets are kept.
+func (g *Group) SetInterval(interval time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.global.SetInterval(interval)
+	if g.shared != nil {
+		g.shared.SetInterval(interval)
+	}
+}
+
+// Wait blocks until the budget of key, the global limiter and the shared budget all allow an operation,
+// ctx is done or the group is stopped.
+func (g *Group) Wait(ctx context.Context, key string) error {
+	g.mu.Lock()
+	limiter, shared := g.keys[key], g.shared
+	g.mu.Unlock()
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if err := g.global.Wait(ctx); err != nil {
+		return err
+	}
+	if shared != nil {
+		return shared.Wait(ctx)
+	}
+	return nil
+}
+
+// Stop stops the global limiter, every budget and the shared budget.
+func (g *Group) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, limiter := range g.keys {
+		limiter.Stop()
+	}
+	if g.shared != nil {
+		g.shared.Stop()
 	}
+	g.global.Stop()
 }
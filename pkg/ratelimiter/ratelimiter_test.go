@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n callers are queued in r.
+func waitQueued(t *testing.T, r *RateLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		queued := len(r.queue)
+		r.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	r := New(time.Hour, 3)
+	defer r.Stop()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := r.Wait(ctx); err != nil {
+			t.Fatalf("Wait %d of the burst: %v", i+1, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := r.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait past the burst = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRateLimiterServesWaitersInOrder(t *testing.T) {
+	r := New(time.Hour, 1)
+	defer r.Stop()
+	if err := r.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	var mu sync.Mutex
+	var served []int
+	var wg sync.WaitGroup
+	cancels := make([]context.CancelFunc, 5)
+	errs := make([]error, 5)
+	for i := range cancels {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.Wait(ctx)
+			if errs[i] == nil {
+				mu.Lock()
+				served = append(served, i)
+				mu.Unlock()
+			}
+		}()
+		waitQueued(t, r, i+1) // Queue the callers one after the other.
+	}
+
+	// A caller that gives up leaves the queue without using a token.
+	cancels[2]()
+	waitQueued(t, r, 4)
+
+	// Hand out tokens one at a time, far enough apart for each caller to record its turn.
+	r.SetInterval(10 * time.Millisecond)
+	wg.Wait()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	if want := []int{0, 1, 3, 4}; !slices.Equal(served, want) {
+		t.Errorf("served callers %v, want %v", served, want)
+	}
+	if !errors.Is(errs[2], context.Canceled) {
+		t.Errorf("cancelled caller got %v, want %v", errs[2], context.Canceled)
+	}
+}
+
+func TestRateLimiterStop(t *testing.T) {
+	r := New(time.Hour, 1)
+	if err := r.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- r.Wait(context.Background()) }()
+	waitQueued(t, r, 1)
+
+	r.Stop()
+	if err := <-errc; !errors.Is(err, ErrStopped) {
+		t.Errorf("pending Wait = %v, want %v", err, ErrStopped)
+	}
+	if err := r.Wait(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Errorf("Wait after Stop = %v, want %v", err, ErrStopped)
+	}
+}
+
+func TestGroupWaitsForKeyBudget(t *testing.T) {
+	g := NewGroup(New(0, 1))
+	defer g.Stop()
+	g.SetLimit("slow", time.Hour, 1)
+	ctx := context.Background()
+	if err := g.Wait(ctx, "slow"); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	// The slow budget is used up, but other keys are only limited by the global limiter.
+	if err := g.Wait(ctx, "other"); err != nil {
+		t.Fatalf("Wait on another key: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second Wait on the slow key = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
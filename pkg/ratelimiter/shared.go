@@ -0,0 +1,134 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/internal/fs"
+)
+
+// maxSharedBacklog bounds how far ahead the shared schedule may be, so that a corrupt state file or a
+// clock moved backwards cannot stall every process.
+const maxSharedBacklog = time.Hour
+
+// Shared is a token-bucket rate limiter whose budget is shared by every process using the same state
+// file, so that several instances on one host stay within a single budget. The file holds the time at
+// which the bucket will be full again, and is only updated under an exclusive file lock.
+type Shared struct {
+	interval time.Duration
+	burst    int
+
+	mu       sync.Mutex
+	file     *os.File
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewShared creates a Shared limiter backed by the state file at path, creating the file if needed.
+// It allows one operation per interval across all processes, with bursts of up to burst operations.
+func NewShared(path string, interval time.Duration, burst int) (*Shared, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rate limit state file: %w", err)
+	}
+	// Make sure the file can be locked before relying on it.
+	if err := fs.Lock(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to lock rate limit state file: %w", err)
+	}
+	if err := fs.Unlock(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to unlock rate limit state file: %w", err)
+	}
+	return &Shared{interval: interval, burst: max(burst, 1), file: f, stopped: make(chan struct{})}, nil
+}
+
+// Wait blocks until the shared budget allows an operation, ctx is done or the limiter is stopped.
+// The slot is reserved before waiting, so a caller whose ctx is done still uses up its slot.
+func (s *Shared) Wait(ctx context.Context) error {
+	select {
+	case <-s.stopped:
+		return ErrStopped
+	default:
+	}
+	at, err := s.reserve()
+	if err != nil {
+		return err
+	}
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-s.stopped:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetInterval changes the interval at which this process takes slots. Other processes keep their own interval.
+func (s *Shared) SetInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = interval
+}
+
+// Stop closes the state file and makes all pending and future Wait calls return ErrStopped.
+func (s *Shared) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = s.file.Close()
+	})
+}
+
+// reserve takes the next slot from the shared schedule and returns when it starts.
+func (s *Shared) reserve() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stopped:
+		return time.Time{}, ErrStopped
+	default:
+	}
+	if err := fs.Lock(s.file); err != nil {
+		return time.Time{}, fmt.Errorf("failed to lock rate limit state file: %w", err)
+	}
+	defer func() { _ = fs.Unlock(s.file) }()
+
+	now := time.Now()
+	full := now // When the bucket is full again; in the past means it is full now.
+	var buf [8]byte
+	n, err := s.file.ReadAt(buf[:], 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return time.Time{}, fmt.Errorf("failed to read rate limit state file: %w", err)
+	}
+	if n == len(buf) {
+		saved := time.Unix(0, int64(binary.BigEndian.Uint64(buf[:]))) // #nosec G115
+		if saved.After(now) && saved.Before(now.Add(maxSharedBacklog)) {
+			full = saved
+		}
+	}
+
+	at := full.Add(-time.Duration(s.burst-1) * s.interval)
+	if at.Before(now) {
+		at = now
+	}
+	binary.BigEndian.PutUint64(buf[:], uint64(full.Add(s.interval).UnixNano())) // #nosec G115
+	if _, err := s.file.WriteAt(buf[:], 0); err != nil {
+		return time.Time{}, fmt.Errorf("failed to write rate limit state file: %w", err)
+	}
+	return at, nil
+}
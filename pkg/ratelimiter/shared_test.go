@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestShared creates a Shared limiter on the state file at path, stopped at the end of the test.
+func newTestShared(t *testing.T, path string, interval time.Duration, burst int) *Shared {
+	t.Helper()
+	s, err := NewShared(path, interval, burst)
+	if err != nil {
+		t.Fatalf("NewShared: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// checkSlot fails the test unless s reserves a slot starting about offset from now.
+func checkSlot(t *testing.T, s *Shared, offset time.Duration) {
+	t.Helper()
+	now := time.Now()
+	at, err := s.reserve()
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if got := at.Sub(now); got < offset-time.Second || got > offset+time.Second {
+		t.Errorf("reserved a slot %v from now, want %v", got.Round(time.Second), offset)
+	}
+}
+
+func TestSharedReserveAcrossInstances(t *testing.T) {
+	const interval = time.Minute
+	path := filepath.Join(t.TempDir(), "history.db.ratelimit")
+	// Two limiters on the same file stand for two processes.
+	a := newTestShared(t, path, interval, 1)
+	b := newTestShared(t, path, interval, 1)
+
+	checkSlot(t, a, 0)
+	checkSlot(t, b, interval)
+	checkSlot(t, a, 2*interval)
+}
+
+func TestSharedReserveBurst(t *testing.T) {
+	const interval = time.Minute
+	path := filepath.Join(t.TempDir(), "history.db.ratelimit")
+	a := newTestShared(t, path, interval, 2)
+	b := newTestShared(t, path, interval, 2)
+
+	checkSlot(t, a, 0)
+	checkSlot(t, b, 0)
+	checkSlot(t, a, interval)
+	checkSlot(t, b, 2*interval)
+}
+
+func TestSharedReserveIgnoresBadState(t *testing.T) {
+	const interval = time.Minute
+	tests := []struct {
+		name  string
+		state time.Time
+	}{
+		{"past", time.Now().Add(-time.Hour)},
+		{"too far ahead", time.Now().Add(2 * maxSharedBacklog)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.db.ratelimit")
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], uint64(tt.state.UnixNano()))
+			if err := os.WriteFile(path, buf[:], 0600); err != nil {
+				t.Fatal(err)
+			}
+			s := newTestShared(t, path, interval, 1)
+			checkSlot(t, s, 0)
+			checkSlot(t, s, interval)
+		})
+	}
+}
+
+func TestSharedStop(t *testing.T) {
+	s := newTestShared(t, filepath.Join(t.TempDir(), "history.db.ratelimit"), time.Hour, 1)
+	ctx := context.Background()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- s.Wait(ctx) }()
+	time.Sleep(10 * time.Millisecond) // Let the second Wait reserve its slot.
+
+	s.Stop()
+	if err := <-errc; !errors.Is(err, ErrStopped) {
+		t.Errorf("pending Wait = %v, want %v", err, ErrStopped)
+	}
+	if err := s.Wait(ctx); !errors.Is(err, ErrStopped) {
+		t.Errorf("Wait after Stop = %v, want %v", err, ErrStopped)
+	}
+}
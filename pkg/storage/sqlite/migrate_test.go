@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// baselineSchema is the schema of databases created before migrations were added, with the feed cache that
+// could already be there.
+const baselineSchema = `
+CREATE TABLE posts (
+    id TEXT PRIMARY KEY,
+    author_id TEXT NOT NULL,
+    create_time INTEGER NOT NULL,
+    has_sd BOOLEAN NOT NULL DEFAULT 0,
+    has_hd BOOLEAN NOT NULL DEFAULT 0,
+    has_source BOOLEAN NOT NULL DEFAULT 0,
+    has_cover_medium BOOLEAN NOT NULL DEFAULT 0,
+    has_cover_origin BOOLEAN NOT NULL DEFAULT 0,
+    has_cover_dynamic BOOLEAN NOT NULL DEFAULT 0,
+    sha256_sd TEXT,
+    sha256_hd TEXT,
+    sha256_source TEXT,
+    sha256_cover_medium TEXT,
+    sha256_cover_origin TEXT,
+    sha256_cover_dynamic TEXT,
+    downloaded_at TIMESTAMP
+);
+CREATE TABLE avatars (
+    author_id TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    downloaded_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (author_id, sha256)
+);
+CREATE TABLE feed_cache (
+    feed TEXT NOT NULL,
+    post_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    create_time INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    PRIMARY KEY (feed, post_id)
+);
+INSERT INTO posts (id, author_id, create_time, has_hd, sha256_hd) VALUES ('100', 'creator', 1700000000, 1, 'hd-hash');
+INSERT INTO posts (id, author_id, create_time, has_hd, sha256_hd) VALUES ('200_1_2', 'creator', 1700000100, 1, 'photo-hash');
+INSERT INTO feed_cache (feed, post_id, seq, create_time, data) VALUES
+    ('creator', '100', 3, 1700000000, '{"id":"100","title":"video","duration":12,"author":{"unique_id":"creator"}}'),
+    ('creator', '200', 2, 1700000100, '{"id":"200","title":"album","images":["a","b"],"author":{"unique_id":"creator"}}'),
+    ('creator', '300', 1, 1700000200, '{"id":"300","title":"not downloaded","author":{"unique_id":"creator"}}');
+`
+
+// userVersion returns the schema version recorded in db.
+func userVersion(t *testing.T, db *DB) int {
+	t.Helper()
+	var version int
+	if err := db.Conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatalf("PRAGMA user_version: %v", err)
+	}
+	return version
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(baselineSchema); err != nil {
+		t.Fatalf("failed to create baseline database: %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("New on a baseline database: %v", err)
+	}
+	if v := userVersion(t, db); v != 4 {
+		t.Errorf("user_version %d after migrating, want 4", v)
+	}
+
+	// Downloads recorded before the migrations are kept.
+	if ok, err := db.AssetExists("100", tikwm.AssetHD); err != nil || !ok {
+		t.Errorf("AssetExists of a baseline download = %v, %v; want true, nil", ok, err)
+	}
+	// 001 and 002 add the watermarked and quality columns.
+	if err := db.AddOrUpdateAsset("100", "creator", 1700000000, tikwm.AssetWatermarked, "wm-hash"); err != nil {
+		t.Errorf("AddOrUpdateAsset of a watermarked video: %v", err)
+	}
+	if err := db.SetPostQuality("100", tikwm.AssetHD); err != nil {
+		t.Errorf("SetPostQuality: %v", err)
+	}
+	records, err := db.GetPostsByAuthor("creator")
+	if err != nil {
+		t.Fatalf("GetPostsByAuthor: %v", err)
+	}
+	i := slices.IndexFunc(records, func(r storage.PostRecord) bool { return r.ID == "100" })
+	if i < 0 || records[i].Quality != tikwm.AssetHD {
+		t.Errorf("GetPostsByAuthor = %+v, want post 100 with quality %s", records, tikwm.AssetHD)
+	}
+
+	// 003 fills in the metadata of the downloaded posts from the feed cache, albums included.
+	for _, tt := range []struct {
+		id         string
+		title      string
+		imageCount int
+	}{
+		{"100", "video", 0},
+		{"200", "album", 2},
+	} {
+		metadata, err := db.GetPostMetadata(tt.id)
+		if err != nil {
+			t.Fatalf("GetPostMetadata(%s): %v", tt.id, err)
+		}
+		if metadata == nil || metadata.Title != tt.title || metadata.AuthorID != "creator" || metadata.ImageCount != tt.imageCount {
+			t.Errorf("metadata of post %s = %+v, want title %q by creator with %d images", tt.id, metadata, tt.title, tt.imageCount)
+		}
+	}
+	if metadata, err := db.GetPostMetadata("300"); err != nil || metadata != nil {
+		t.Errorf("metadata of a post that was not downloaded = %+v, %v; want nil, nil", metadata, err)
+	}
+
+	// 004 adds the stats tables.
+	if _, err := db.GetPostStats("100", time.Time{}); err != nil {
+		t.Errorf("GetPostStats: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the migrated database again applies nothing.
+	db = newTestDBAt(t, path)
+	if v := userVersion(t, db); v != 4 {
+		t.Errorf("user_version %d after reopening, want 4", v)
+	}
+	if ok, err := db.AssetExists("100", tikwm.AssetWatermarked); err != nil || !ok {
+		t.Errorf("AssetExists of the watermarked video after reopening = %v, %v; want true, nil", ok, err)
+	}
+}
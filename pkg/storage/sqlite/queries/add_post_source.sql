@@ -0,0 +1 @@
+INSERT OR IGNORE INTO post_sources (post_id, source_type, source, found_at) VALUES (?, ?, ?, ?);
@@ -0,0 +1,14 @@
+-- Only record a snapshot when a counter changed since the post's latest snapshot.
+INSERT OR IGNORE INTO post_stats (post_id, author_id, observed_at, play_count, digg_count, comment_count, share_count, collect_count, download_count)
+SELECT :post_id, :author_id, :observed_at, :play_count, :digg_count, :comment_count, :share_count, :collect_count, :download_count
+WHERE NOT EXISTS (
+    SELECT 1 FROM (
+        SELECT * FROM post_stats WHERE post_id = :post_id ORDER BY observed_at DESC LIMIT 1
+    ) latest
+    WHERE latest.play_count = :play_count
+        AND latest.digg_count = :digg_count
+        AND latest.comment_count = :comment_count
+        AND latest.share_count = :share_count
+        AND latest.collect_count = :collect_count
+        AND latest.download_count = :download_count
+);
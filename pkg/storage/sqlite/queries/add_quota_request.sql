@@ -0,0 +1,3 @@
+INSERT INTO api_quota (identity, day, requests) VALUES (?, ?, 1)
+ON CONFLICT(identity, day) DO UPDATE SET requests = requests + 1
+RETURNING requests;
@@ -0,0 +1,13 @@
+-- Only record a snapshot when a counter changed since the user's latest snapshot.
+INSERT OR IGNORE INTO user_stats (author_id, observed_at, follower_count, following_count, heart_count, video_count, digg_count)
+SELECT :author_id, :observed_at, :follower_count, :following_count, :heart_count, :video_count, :digg_count
+WHERE NOT EXISTS (
+    SELECT 1 FROM (
+        SELECT * FROM user_stats WHERE author_id = :author_id ORDER BY observed_at DESC LIMIT 1
+    ) latest
+    WHERE latest.follower_count = :follower_count
+        AND latest.following_count = :following_count
+        AND latest.heart_count = :heart_count
+        AND latest.video_count = :video_count
+        AND latest.digg_count = :digg_count
+);
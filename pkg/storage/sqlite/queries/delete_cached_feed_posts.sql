@@ -0,0 +1 @@
+DELETE FROM feed_cache WHERE feed = ?;
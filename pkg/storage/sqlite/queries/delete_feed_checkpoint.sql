@@ -0,0 +1 @@
+DELETE FROM feed_checkpoints WHERE target = ?;
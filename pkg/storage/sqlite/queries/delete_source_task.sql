@@ -0,0 +1 @@
+DELETE FROM source_tasks WHERE video_id = ?;
@@ -0,0 +1,14 @@
+SELECT id, author_id, create_time, title, duration, region, music_id, is_ad, image_count, raw_json, updated_at
+FROM post_metadata
+WHERE (:author_id = '' OR author_id = :author_id)
+    AND (:since = 0 OR create_time >= :since)
+    AND (:until = 0 OR create_time < :until)
+    AND (:min_duration = 0 OR duration >= :min_duration)
+    AND (:max_duration = 0 OR duration <= :max_duration)
+    AND (:region = '' OR region = :region)
+    AND (:music_id = '' OR music_id = :music_id)
+    AND (:title = '' OR instr(lower(title), lower(:title)) > 0)
+    AND (:kind = '' OR (:kind = 'album') = (image_count > 0))
+    AND (NOT :exclude_ads OR NOT is_ad)
+ORDER BY create_time DESC
+LIMIT :limit;
@@ -0,0 +1 @@
+SELECT data FROM feed_cache WHERE feed = ? ORDER BY seq DESC;
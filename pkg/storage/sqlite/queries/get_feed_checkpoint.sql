@@ -0,0 +1 @@
+SELECT target, cursor, post_id, feed_order, updated_at FROM feed_checkpoints WHERE target = ?;
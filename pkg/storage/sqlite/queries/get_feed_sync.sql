@@ -0,0 +1 @@
+SELECT synced_at, full_scan_at FROM feed_syncs WHERE feed = ?;
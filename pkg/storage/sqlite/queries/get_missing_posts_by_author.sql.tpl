@@ -1,4 +1,6 @@
-SELECT id, author_id, create_time, (has_cover_medium OR has_cover_origin OR has_cover_dynamic) as has_cover
+-- Album photos are recorded as "<post ID>_<photo>_<photos>" and are left out. The '_' is escaped, as an unescaped
+-- '_' matches any character.
+SELECT id, author_id, create_time, (has_cover_medium OR has_cover_origin OR has_cover_dynamic) as has_cover, COALESCE(quality, '') as quality
 FROM posts
-WHERE author_id = ? AND {{.HasColumn}} = 0 AND id NOT LIKE '%_%'
+WHERE author_id = ? AND {{.HasColumn}} = 0 AND id NOT LIKE '%\_%' ESCAPE '\'
 ORDER BY create_time DESC;
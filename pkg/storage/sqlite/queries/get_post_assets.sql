@@ -0,0 +1,6 @@
+SELECT id, downloaded_at,
+    has_source, sha256_source, has_hd, sha256_hd, has_sd, sha256_sd, has_wm, sha256_wm,
+    has_cover_medium, sha256_cover_medium, has_cover_origin, sha256_cover_origin, has_cover_dynamic, sha256_cover_dynamic
+FROM posts
+WHERE id = ? OR id LIKE ? ESCAPE '\'
+ORDER BY length(id), id;
@@ -0,0 +1,3 @@
+SELECT id, author_id, create_time, title, duration, region, music_id, is_ad, image_count, raw_json, updated_at
+FROM post_metadata
+WHERE id = ?;
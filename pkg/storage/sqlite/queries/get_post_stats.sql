@@ -0,0 +1,6 @@
+-- The latest snapshot at or before :since is included, as it holds the stats at that time.
+SELECT s.post_id, s.author_id, s.observed_at, s.play_count, s.digg_count, s.comment_count, s.share_count, s.collect_count, s.download_count
+FROM post_stats s
+WHERE s.post_id = :post_id
+    AND s.observed_at >= COALESCE((SELECT MAX(b.observed_at) FROM post_stats b WHERE b.post_id = s.post_id AND b.observed_at <= :since), :since)
+ORDER BY s.observed_at;
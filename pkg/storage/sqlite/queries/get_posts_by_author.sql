@@ -1,4 +1,4 @@
-SELECT id, author_id, create_time, (has_cover_medium OR has_cover_origin OR has_cover_dynamic) as has_cover
+SELECT id, author_id, create_time, (has_cover_medium OR has_cover_origin OR has_cover_dynamic) as has_cover, COALESCE(quality, '') as quality
 FROM posts
 WHERE author_id = ?
 ORDER BY create_time DESC;
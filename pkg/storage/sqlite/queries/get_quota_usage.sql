@@ -0,0 +1 @@
+SELECT identity, day, requests, exhausted_at FROM api_quota WHERE day >= ? ORDER BY day, identity;
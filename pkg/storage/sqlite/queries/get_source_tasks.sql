@@ -0,0 +1 @@
+SELECT video_id, task_id, submitted_at, play_url, size FROM source_tasks ORDER BY submitted_at;
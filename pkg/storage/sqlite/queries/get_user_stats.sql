@@ -0,0 +1,6 @@
+-- The latest snapshot at or before :since is included, as it holds the stats at that time.
+SELECT s.author_id, s.observed_at, s.follower_count, s.following_count, s.heart_count, s.video_count, s.digg_count
+FROM user_stats s
+WHERE s.author_id = :author_id
+    AND s.observed_at >= COALESCE((SELECT MAX(b.observed_at) FROM user_stats b WHERE b.author_id = s.author_id AND b.observed_at <= :since), :since)
+ORDER BY s.observed_at;
@@ -0,0 +1 @@
+INSERT OR IGNORE INTO post_music (post_id, music_id) VALUES (?, ?);
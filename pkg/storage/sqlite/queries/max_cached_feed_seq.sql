@@ -0,0 +1 @@
+SELECT COALESCE(MAX(seq), 0) FROM feed_cache WHERE feed = ?;
@@ -0,0 +1,2 @@
+ALTER TABLE posts ADD COLUMN has_wm BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN sha256_wm TEXT;
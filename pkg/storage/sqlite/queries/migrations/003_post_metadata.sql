@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS post_metadata (
+    id TEXT PRIMARY KEY,
+    author_id TEXT NOT NULL,
+    create_time INTEGER NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    duration INTEGER NOT NULL DEFAULT 0,
+    region TEXT NOT NULL DEFAULT '',
+    music_id TEXT NOT NULL DEFAULT '',
+    is_ad BOOLEAN NOT NULL DEFAULT 0,
+    image_count INTEGER NOT NULL DEFAULT 0,
+    raw_json TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_post_metadata_author_create_time ON post_metadata (author_id, create_time);
+CREATE INDEX IF NOT EXISTS idx_post_metadata_music_id ON post_metadata (music_id);
+
+-- Fill in the posts already downloaded from the feeds in the feed cache. Album photos are recorded as
+-- "<post ID>_<photo>_<photos>", which sort between "<post ID>_" and "<post ID>`".
+INSERT OR IGNORE INTO post_metadata (id, author_id, create_time, title, duration, region, music_id, is_ad, image_count, raw_json, updated_at)
+SELECT c.post_id,
+    COALESCE(json_extract(c.data, '$.author.unique_id'), ''),
+    c.create_time,
+    COALESCE(json_extract(c.data, '$.title'), ''),
+    COALESCE(json_extract(c.data, '$.duration'), 0),
+    COALESCE(json_extract(c.data, '$.region'), ''),
+    COALESCE(json_extract(c.data, '$.music_info.id'), ''),
+    COALESCE(json_extract(c.data, '$.is_ad'), 0),
+    COALESCE(json_array_length(c.data, '$.images'), 0),
+    c.data,
+    CURRENT_TIMESTAMP
+FROM feed_cache c
+WHERE EXISTS (
+    SELECT 1 FROM posts p
+    WHERE p.id = c.post_id OR (p.id > c.post_id || '_' AND p.id < c.post_id || '`')
+);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS post_stats (
+    post_id TEXT NOT NULL,
+    author_id TEXT NOT NULL,
+    observed_at TIMESTAMP NOT NULL,
+    play_count INTEGER NOT NULL,
+    digg_count INTEGER NOT NULL,
+    comment_count INTEGER NOT NULL,
+    share_count INTEGER NOT NULL,
+    collect_count INTEGER NOT NULL,
+    download_count INTEGER NOT NULL,
+    PRIMARY KEY (post_id, observed_at)
+);
+CREATE INDEX IF NOT EXISTS idx_post_stats_author_observed_at ON post_stats (author_id, observed_at);
+
+CREATE TABLE IF NOT EXISTS user_stats (
+    author_id TEXT NOT NULL,
+    observed_at TIMESTAMP NOT NULL,
+    follower_count INTEGER NOT NULL,
+    following_count INTEGER NOT NULL,
+    heart_count INTEGER NOT NULL,
+    video_count INTEGER NOT NULL,
+    digg_count INTEGER NOT NULL,
+    PRIMARY KEY (author_id, observed_at)
+);
@@ -0,0 +1 @@
+SELECT {{.Column}} FROM music WHERE id = ?;
@@ -0,0 +1,6 @@
+INSERT INTO feed_checkpoints (target, cursor, post_id, feed_order, updated_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(target) DO UPDATE SET
+    cursor = excluded.cursor,
+    post_id = excluded.post_id,
+    feed_order = excluded.feed_order,
+    updated_at = excluded.updated_at;
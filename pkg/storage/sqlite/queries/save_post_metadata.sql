@@ -0,0 +1,13 @@
+INSERT INTO post_metadata (id, author_id, create_time, title, duration, region, music_id, is_ad, image_count, raw_json, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET
+    author_id = excluded.author_id,
+    create_time = excluded.create_time,
+    title = excluded.title,
+    duration = excluded.duration,
+    region = excluded.region,
+    music_id = excluded.music_id,
+    is_ad = excluded.is_ad,
+    image_count = excluded.image_count,
+    raw_json = excluded.raw_json,
+    updated_at = excluded.updated_at;
@@ -0,0 +1,6 @@
+INSERT INTO source_tasks (video_id, task_id, submitted_at, play_url, size) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(video_id) DO UPDATE SET
+    task_id = excluded.task_id,
+    submitted_at = excluded.submitted_at,
+    play_url = excluded.play_url,
+    size = excluded.size;
@@ -24,3 +24,72 @@ CREATE TABLE IF NOT EXISTS avatars (
     downloaded_at TIMESTAMP NOT NULL,
     PRIMARY KEY (author_id, sha256)
 );
+
+CREATE TABLE IF NOT EXISTS music (
+    id TEXT PRIMARY KEY,
+    title TEXT,
+    author TEXT,
+    album TEXT,
+    original BOOLEAN NOT NULL DEFAULT 0,
+    has_audio BOOLEAN NOT NULL DEFAULT 0,
+    has_cover BOOLEAN NOT NULL DEFAULT 0,
+    sha256_audio TEXT,
+    sha256_cover TEXT,
+    downloaded_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS post_music (
+    post_id TEXT NOT NULL,
+    music_id TEXT NOT NULL,
+    PRIMARY KEY (post_id, music_id)
+);
+CREATE INDEX IF NOT EXISTS idx_post_music_music_id ON post_music (music_id);
+
+CREATE TABLE IF NOT EXISTS post_sources (
+    post_id TEXT NOT NULL,
+    source_type TEXT NOT NULL,
+    source TEXT NOT NULL,
+    found_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, source_type, source)
+);
+CREATE INDEX IF NOT EXISTS idx_post_sources_source ON post_sources (source_type, source);
+
+CREATE TABLE IF NOT EXISTS feed_syncs (
+    feed TEXT PRIMARY KEY,
+    synced_at TIMESTAMP NOT NULL,
+    full_scan_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS feed_cache (
+    feed TEXT NOT NULL,
+    post_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    create_time INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    PRIMARY KEY (feed, post_id)
+);
+CREATE INDEX IF NOT EXISTS idx_feed_cache_seq ON feed_cache (feed, seq);
+
+CREATE TABLE IF NOT EXISTS feed_checkpoints (
+    target TEXT PRIMARY KEY,
+    cursor TEXT NOT NULL,
+    post_id TEXT NOT NULL,
+    feed_order TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS source_tasks (
+    video_id TEXT PRIMARY KEY,
+    task_id TEXT NOT NULL,
+    submitted_at TIMESTAMP NOT NULL,
+    play_url TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS api_quota (
+    identity TEXT NOT NULL,
+    day TEXT NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    exhausted_at TIMESTAMP,
+    PRIMARY KEY (identity, day)
+);
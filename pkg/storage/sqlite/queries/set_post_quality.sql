@@ -0,0 +1 @@
+UPDATE posts SET quality = ? WHERE id = ?;
@@ -0,0 +1,2 @@
+INSERT INTO api_quota (identity, day, exhausted_at) VALUES (?, ?, ?)
+ON CONFLICT(identity, day) DO UPDATE SET exhausted_at = COALESCE(exhausted_at, excluded.exhausted_at);
@@ -0,0 +1,4 @@
+INSERT INTO feed_cache (feed, post_id, seq, create_time, data) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(feed, post_id) DO UPDATE SET
+    create_time = excluded.create_time,
+    data = excluded.data;
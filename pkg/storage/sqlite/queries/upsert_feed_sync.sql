@@ -0,0 +1,4 @@
+INSERT INTO feed_syncs (feed, synced_at, full_scan_at) VALUES (?, ?, ?)
+ON CONFLICT(feed) DO UPDATE SET
+    synced_at = excluded.synced_at,
+    full_scan_at = COALESCE(excluded.full_scan_at, feed_syncs.full_scan_at);
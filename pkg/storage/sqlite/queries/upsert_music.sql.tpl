@@ -0,0 +1,10 @@
+INSERT INTO music (id, title, author, album, original, {{.HasColumn}}, {{.ShaColumn}}, downloaded_at)
+VALUES (?, ?, ?, ?, ?, 1, ?, ?)
+ON CONFLICT(id) DO UPDATE SET
+    title = excluded.title,
+    author = excluded.author,
+    album = excluded.album,
+    original = excluded.original,
+    {{.HasColumn}} = 1,
+    {{.ShaColumn}} = excluded.{{.ShaColumn}},
+    downloaded_at = excluded.downloaded_at;
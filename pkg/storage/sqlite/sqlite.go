@@ -2,22 +2,27 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"text/template"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
+	"github.com/perpetuallyhorni/tikwm/pkg/network"
 	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
 )
 
 //go:embed queries/*.sql
 //go:embed queries/*.sql.tpl
+//go:embed queries/migrations/*.sql
 var queryFS embed.FS
 
 // DB is a SQLite implementation of the storage.Storer interface.
@@ -25,6 +30,19 @@ type DB struct {
 	Conn *sql.DB // The raw database connection, exposed for extensibility.
 }
 
+// DB implements every optional store of the storage package along with storage.Storer.
+var (
+	_ storage.Storer          = (*DB)(nil)
+	_ storage.MusicStore      = (*DB)(nil)
+	_ storage.PostSourceStore = (*DB)(nil)
+	_ storage.CheckpointStore = (*DB)(nil)
+	_ storage.FeedCacheStore  = (*DB)(nil)
+	_ storage.SourceTaskStore = (*DB)(nil)
+	_ storage.QualityStore    = (*DB)(nil)
+	_ storage.MetadataStore   = (*DB)(nil)
+	_ storage.StatsStore      = (*DB)(nil)
+)
+
 // New creates a new SQLite database connection and ensures the schema is up to date.
 // It returns a concrete *DB type to allow for extension.
 func New(path string) (*DB, error) {
@@ -47,6 +65,10 @@ func New(path string) (*DB, error) {
 		_ = instance.Close()
 		return nil, fmt.Errorf("failed to create database schema: %w", err)
 	}
+	if err := instance.migrate(); err != nil {
+		_ = instance.Close()
+		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
+	}
 
 	return instance, nil
 }
@@ -83,6 +105,58 @@ func (db *DB) createSchema() error {
 	return err
 }
 
+// migrate applies the migrations in queries/migrations that the database does not have yet, on top of schema.sql.
+// Migrations are named after their number, starting at 1, and the database's user_version records the last one
+// applied. The migrations run in a single write transaction, so that processes opening the database at the same
+// time cannot apply them twice.
+func (db *DB) migrate() (err error) {
+	entries, err := fs.ReadDir(queryFS, "queries/migrations") // Sorted by name, so by number.
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	conn, err := db.Conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_, _ = conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		var number int
+		if _, err := fmt.Sscanf(entry.Name(), "%d_", &number); err != nil {
+			return fmt.Errorf("invalid migration name %s: %w", entry.Name(), err)
+		}
+		if number <= version {
+			continue
+		}
+		query, err := getQuery("migrations/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("migration %s failed: %w", entry.Name(), err)
+		}
+		// PRAGMA statements cannot take parameters.
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", number)); err != nil {
+			return err
+		}
+	}
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	return err
+}
+
 // AddAvatar adds a record for a downloaded user avatar.
 func (db *DB) AddAvatar(authorID, sha256 string) error {
 	query, err := getQuery("add_avatar.sql")
@@ -120,6 +194,8 @@ func (db *DB) AddOrUpdateAsset(postID, authorID string, createTime int64, assetT
 		hasColumn, shaColumn = "has_hd", "sha256_hd"
 	case tikwm.AssetSource:
 		hasColumn, shaColumn = "has_source", "sha256_source"
+	case tikwm.AssetWatermarked:
+		hasColumn, shaColumn = "has_wm", "sha256_wm"
 	case tikwm.AssetCoverMedium:
 		hasColumn, shaColumn = "has_cover_medium", "sha256_cover_medium"
 	case tikwm.AssetCoverOrigin:
@@ -165,6 +241,8 @@ func (db *DB) AssetExists(assetID string, assetType tikwm.AssetType) (bool, erro
 		column = "has_hd"
 	case tikwm.AssetSource:
 		column = "has_source"
+	case tikwm.AssetWatermarked:
+		column = "has_wm"
 	case tikwm.AssetCoverMedium:
 		column = "has_cover_medium"
 	case tikwm.AssetCoverOrigin:
@@ -192,6 +270,372 @@ func (db *DB) AssetExists(assetID string, assetType tikwm.AssetType) (bool, erro
 	return exists, nil
 }
 
+// musicColumns returns the has/sha256 columns of the music table for a music asset type.
+func musicColumns(assetType tikwm.AssetType) (string, string, error) {
+	switch assetType {
+	case tikwm.AssetMusic:
+		return "has_audio", "sha256_audio", nil
+	case tikwm.AssetMusicCover:
+		return "has_cover", "sha256_cover", nil
+	}
+	return "", "", fmt.Errorf("unknown music asset type: %s", assetType)
+}
+
+// AddOrUpdateMusic upserts a music record and marks the given music asset as downloaded.
+func (db *DB) AddOrUpdateMusic(music *tikwm.MusicInfo, assetType tikwm.AssetType, sha256 string) error {
+	hasColumn, shaColumn, err := musicColumns(assetType)
+	if err != nil {
+		return err
+	}
+	query, err := getParsedQuery("upsert_music.sql.tpl", struct {
+		HasColumn string
+		ShaColumn string
+	}{
+		HasColumn: hasColumn,
+		ShaColumn: shaColumn,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn.Exec(query, music.Id, music.Title, music.Author, music.Album, music.Original, sha256, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to execute upsert for music %s (type: %s): %w", music.Id, assetType, err)
+	}
+	return nil
+}
+
+// MusicExists checks if a specific asset for a music ID exists in the database.
+func (db *DB) MusicExists(musicID string, assetType tikwm.AssetType) (bool, error) {
+	column, _, err := musicColumns(assetType)
+	if err != nil {
+		return false, err
+	}
+	query, err := getParsedQuery("music_exists.sql.tpl", struct{ Column string }{Column: column})
+	if err != nil {
+		return false, err
+	}
+	var exists bool
+	err = db.Conn.QueryRow(query, musicID).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check if music %s exists: %w", musicID, err)
+	}
+	return exists, nil
+}
+
+// LinkPostMusic records that a post uses a music track.
+func (db *DB) LinkPostMusic(postID, musicID string) error {
+	query, err := getQuery("link_post_music.sql")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Conn.Exec(query, postID, musicID); err != nil {
+		return fmt.Errorf("failed to link post %s to music %s: %w", postID, musicID, err)
+	}
+	return nil
+}
+
+// AddPostSource records that a post was found through a feed other than its author's profile.
+// The first time a post is found through a source is kept.
+func (db *DB) AddPostSource(postID, sourceType, source string) error {
+	query, err := getQuery("add_post_source.sql")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Conn.Exec(query, postID, sourceType, source, time.Now()); err != nil {
+		return fmt.Errorf("failed to record %s source %s for post %s: %w", sourceType, source, postID, err)
+	}
+	return nil
+}
+
+// GetFeedCheckpoint retrieves the checkpoint of a feed, or nil if the feed has none.
+func (db *DB) GetFeedCheckpoint(target string) (*storage.FeedCheckpoint, error) {
+	query, err := getQuery("get_feed_checkpoint.sql")
+	if err != nil {
+		return nil, err
+	}
+	var cp storage.FeedCheckpoint
+	err = db.Conn.QueryRow(query, target).Scan(&cp.Target, &cp.Cursor, &cp.PostID, &cp.Order, &cp.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed checkpoint for %s: %w", target, err)
+	}
+	return &cp, nil
+}
+
+// SaveFeedCheckpoint adds or replaces the checkpoint of a feed.
+func (db *DB) SaveFeedCheckpoint(cp *storage.FeedCheckpoint) error {
+	query, err := getQuery("save_feed_checkpoint.sql")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Conn.Exec(query, cp.Target, cp.Cursor, cp.PostID, cp.Order, time.Now()); err != nil {
+		return fmt.Errorf("failed to save feed checkpoint for %s: %w", cp.Target, err)
+	}
+	return nil
+}
+
+// DeleteFeedCheckpoint deletes the checkpoint of a feed.
+func (db *DB) DeleteFeedCheckpoint(target string) error {
+	query, err := getQuery("delete_feed_checkpoint.sql")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Conn.Exec(query, target); err != nil {
+		return fmt.Errorf("failed to delete feed checkpoint for %s: %w", target, err)
+	}
+	return nil
+}
+
+// GetCachedFeed retrieves the cached listing of a feed, or nil if the feed has never been cached.
+func (db *DB) GetCachedFeed(feed string) (*storage.CachedFeed, error) {
+	query, err := getQuery("get_feed_sync.sql")
+	if err != nil {
+		return nil, err
+	}
+	cached := &storage.CachedFeed{Feed: feed}
+	var fullScanAt sql.NullTime
+	err = db.Conn.QueryRow(query, feed).Scan(&cached.SyncedAt, &fullScanAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync state of feed %s: %w", feed, err)
+	}
+	cached.FullScanAt = fullScanAt.Time
+
+	query, err = getQuery("get_cached_feed_posts.sql")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn.Query(query, feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cached posts of feed %s: %w", feed, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan cached post row: %w", err)
+		}
+		var post tikwm.Post
+		if err := json.Unmarshal(data, &post); err != nil {
+			return nil, fmt.Errorf("failed to parse cached post of feed %s: %w", feed, err)
+		}
+		cached.Posts = append(cached.Posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for feed %s: %w", feed, err)
+	}
+	return cached, nil
+}
+
+// ReplaceCachedFeed replaces the cached listing of a feed after a full scan.
+func (db *DB) ReplaceCachedFeed(feed string, posts []tikwm.Post) error {
+	return db.updateCachedFeed(feed, posts, true)
+}
+
+// MergeCachedFeed adds posts to the top of a feed's cached listing, keeping the position of posts already cached.
+func (db *DB) MergeCachedFeed(feed string, posts []tikwm.Post) error {
+	return db.updateCachedFeed(feed, posts, false)
+}
+
+// updateCachedFeed writes posts, newest first, to the cached listing of a feed in a single transaction.
+// If full is true, the previous listing is discarded and the full scan time is updated.
+func (db *DB) updateCachedFeed(feed string, posts []tikwm.Post, full bool) (err error) {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for feed %s: %w", feed, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var seq int64
+	if full {
+		query, err := getQuery("delete_cached_feed_posts.sql")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, feed); err != nil {
+			return fmt.Errorf("failed to clear cached posts of feed %s: %w", feed, err)
+		}
+	} else {
+		query, err := getQuery("max_cached_feed_seq.sql")
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, feed).Scan(&seq); err != nil {
+			return fmt.Errorf("failed to get last position of feed %s: %w", feed, err)
+		}
+	}
+
+	query, err := getQuery("upsert_cached_feed_post.sql")
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		// Cache posts as the API returned them, so that fields Post does not have are kept.
+		data := []byte(post.Raw)
+		if len(data) == 0 {
+			if data, err = json.Marshal(post); err != nil {
+				return fmt.Errorf("failed to serialize post %s: %w", post.ID(), err)
+			}
+		}
+		// Newer posts get higher positions, above everything already cached.
+		if _, err := tx.Exec(query, feed, post.ID(), seq+int64(len(posts)-i), post.CreateTime, string(data)); err != nil {
+			return fmt.Errorf("failed to cache post %s of feed %s: %w", post.ID(), feed, err)
+		}
+	}
+
+	query, err = getQuery("upsert_feed_sync.sql")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var fullScanAt any
+	if full {
+		fullScanAt = now
+	}
+	if _, err := tx.Exec(query, feed, now, fullScanAt); err != nil {
+		return fmt.Errorf("failed to update sync state of feed %s: %w", feed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cached posts of feed %s: %w", feed, err)
+	}
+	return nil
+}
+
+// GetSourceTasks retrieves all persisted source encode tasks, oldest first.
+func (db *DB) GetSourceTasks() ([]storage.SourceTask, error) {
+	query, err := getQuery("get_source_tasks.sql")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query source tasks: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+	var tasks []storage.SourceTask
+	for rows.Next() {
+		var task storage.SourceTask
+		var result tikwm.SourceEncodeResult
+		if err := rows.Scan(&task.VideoID, &task.TaskID, &task.SubmittedAt, &result.PlayURL, &result.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan source task row: %w", err)
+		}
+		if result.PlayURL != "" {
+			task.Result = &result
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for source tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// SaveSourceTask adds or replaces the source encode task of a video.
+func (db *DB) SaveSourceTask(task *storage.SourceTask) error {
+	query, err := getQuery("save_source_task.sql")
+	if err != nil {
+		return err
+	}
+	var result tikwm.SourceEncodeResult
+	if task.Result != nil {
+		result = *task.Result
+	}
+	if _, err := db.Conn.Exec(query, task.VideoID, task.TaskID, task.SubmittedAt, result.PlayURL, result.Size); err != nil {
+		return fmt.Errorf("failed to save source task for %s: %w", task.VideoID, err)
+	}
+	return nil
+}
+
+// DeleteSourceTask deletes the source encode task of a video.
+func (db *DB) DeleteSourceTask(videoID string) error {
+	query, err := getQuery("delete_source_task.sql")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Conn.Exec(query, videoID); err != nil {
+		return fmt.Errorf("failed to delete source task for %s: %w", videoID, err)
+	}
+	return nil
+}
+
+// AddQuotaRequest counts one API request against identity on day and returns the day's count.
+func (db *DB) AddQuotaRequest(identity, day string) (int, error) {
+	query, err := getQuery("add_quota_request.sql")
+	if err != nil {
+		return 0, err
+	}
+	var requests int
+	if err := db.Conn.QueryRow(query, identity, day).Scan(&requests); err != nil {
+		return 0, fmt.Errorf("failed to count API request for %s: %w", identity, err)
+	}
+	return requests, nil
+}
+
+// SetQuotaExhausted records that identity hit the daily API limit at the given time, unless it already did on day.
+func (db *DB) SetQuotaExhausted(identity, day string, at time.Time) error {
+	query, err := getQuery("set_quota_exhausted.sql")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Conn.Exec(query, identity, day, at); err != nil {
+		return fmt.Errorf("failed to save quota exhaustion for %s: %w", identity, err)
+	}
+	return nil
+}
+
+// GetQuotaUsage retrieves the API usage of every identity from day since on, ordered by day.
+func (db *DB) GetQuotaUsage(since string) ([]network.QuotaUsage, error) {
+	query, err := getQuery("get_quota_usage.sql")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API quota usage: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+	var usage []network.QuotaUsage
+	for rows.Next() {
+		var u network.QuotaUsage
+		var exhaustedAt sql.NullTime
+		if err := rows.Scan(&u.Identity, &u.Day, &u.Requests, &exhaustedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API quota row: %w", err)
+		}
+		if exhaustedAt.Valid {
+			u.ExhaustedAt = exhaustedAt.Time
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for API quota usage: %w", err)
+	}
+	return usage, nil
+}
+
 // GetAlbumPhotoCount retrieves the number of downloaded photos for an album.
 func (db *DB) GetAlbumPhotoCount(postID string) (int, error) {
 	query, err := getQuery("count_album_photos.sql")
@@ -220,6 +664,302 @@ func (db *DB) DeletePost(postID string) error {
 	return nil
 }
 
+// SetPostQuality records the rung of the quality ladder that a post's video was downloaded in.
+func (db *DB) SetPostQuality(postID string, quality tikwm.AssetType) error {
+	query, err := getQuery("set_post_quality.sql")
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn.Exec(query, string(quality), postID)
+	if err != nil {
+		return fmt.Errorf("failed to set quality of post %s: %w", postID, err)
+	}
+	return nil
+}
+
+// SavePostMetadata adds or replaces the metadata of a post, such as its title, duration and API payload.
+func (db *DB) SavePostMetadata(post *tikwm.Post) error {
+	query, err := getQuery("save_post_metadata.sql")
+	if err != nil {
+		return err
+	}
+	raw := []byte(post.Raw)
+	if len(raw) == 0 {
+		if raw, err = json.Marshal(post); err != nil {
+			return fmt.Errorf("failed to serialize post %s: %w", post.ID(), err)
+		}
+	}
+	_, err = db.Conn.Exec(query, post.ID(), post.Author.UniqueId, post.CreateTime, post.Title, post.Duration, post.Region,
+		post.MusicInfo.Id, post.IsAd, len(post.Images), string(raw), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save metadata of post %s: %w", post.ID(), err)
+	}
+	return nil
+}
+
+// GetPostMetadata retrieves the metadata of a post. It returns nil if the post has no metadata.
+func (db *DB) GetPostMetadata(postID string) (*storage.PostMetadata, error) {
+	query, err := getQuery("get_post_metadata.sql")
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := scanPostMetadata(db.Conn.QueryRow(query, postID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata of post %s: %w", postID, err)
+	}
+	return metadata, nil
+}
+
+// FindPosts retrieves the metadata of the posts selected by filter, newest first.
+func (db *DB) FindPosts(filter storage.PostFilter) ([]storage.PostMetadata, error) {
+	query, err := getQuery("find_posts.sql")
+	if err != nil {
+		return nil, err
+	}
+	var since, until int64
+	if !filter.Since.IsZero() {
+		since = filter.Since.Unix()
+	}
+	if !filter.Until.IsZero() {
+		until = filter.Until.Unix()
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1 // No limit.
+	}
+	rows, err := db.Conn.Query(query,
+		sql.Named("author_id", filter.AuthorID),
+		sql.Named("since", since),
+		sql.Named("until", until),
+		sql.Named("min_duration", filter.MinDuration),
+		sql.Named("max_duration", filter.MaxDuration),
+		sql.Named("region", filter.Region),
+		sql.Named("music_id", filter.MusicID),
+		sql.Named("title", filter.Title),
+		sql.Named("kind", filter.Kind),
+		sql.Named("exclude_ads", filter.ExcludeAds),
+		sql.Named("limit", limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+
+	var posts []storage.PostMetadata
+	for rows.Next() {
+		metadata, err := scanPostMetadata(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan post metadata row: %w", err)
+		}
+		posts = append(posts, *metadata)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for posts: %w", err)
+	}
+	return posts, nil
+}
+
+// scanPostMetadata scans a row of the post_metadata table, as selected by get_post_metadata.sql.
+func scanPostMetadata(row interface{ Scan(dest ...any) error }) (*storage.PostMetadata, error) {
+	var m storage.PostMetadata
+	var raw string
+	if err := row.Scan(&m.ID, &m.AuthorID, &m.CreateTime, &m.Title, &m.Duration, &m.Region, &m.MusicID, &m.IsAd,
+		&m.ImageCount, &raw, &m.UpdatedAt); err != nil {
+		return nil, err
+	}
+	m.Raw = json.RawMessage(raw)
+	return &m, nil
+}
+
+// AddPostStats records a snapshot of the stats of posts, fetched at a time.
+// Posts whose stats did not change since their latest snapshot are skipped.
+func (db *DB) AddPostStats(posts []tikwm.Post, at time.Time) (err error) {
+	query, err := getQuery("add_post_stats.sql")
+	if err != nil {
+		return err
+	}
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for post stats: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	observedAt := at.UTC().Truncate(time.Second)
+	for _, post := range posts {
+		if post.ID() == "" {
+			continue
+		}
+		if _, err := tx.Exec(query,
+			sql.Named("post_id", post.ID()),
+			sql.Named("author_id", post.Author.UniqueId),
+			sql.Named("observed_at", observedAt),
+			sql.Named("play_count", post.PlayCount),
+			sql.Named("digg_count", post.DiggCount),
+			sql.Named("comment_count", post.CommentCount),
+			sql.Named("share_count", post.ShareCount),
+			sql.Named("collect_count", post.CollectCount),
+			sql.Named("download_count", post.DownloadCount),
+		); err != nil {
+			return fmt.Errorf("failed to save stats of post %s: %w", post.ID(), err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit post stats: %w", err)
+	}
+	return nil
+}
+
+// AddUserStats records a snapshot of the stats of a creator, fetched at a time,
+// unless they did not change since the creator's latest snapshot.
+func (db *DB) AddUserStats(user *tikwm.UserDetail, at time.Time) error {
+	query, err := getQuery("add_user_stats.sql")
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn.Exec(query,
+		sql.Named("author_id", user.User.UniqueId),
+		sql.Named("observed_at", at.UTC().Truncate(time.Second)),
+		sql.Named("follower_count", user.Stats.FollowerCount),
+		sql.Named("following_count", user.Stats.FollowingCount),
+		sql.Named("heart_count", user.Stats.HeartCount),
+		sql.Named("video_count", user.Stats.VideoCount),
+		sql.Named("digg_count", user.Stats.DiggCount),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save stats of user %s: %w", user.User.UniqueId, err)
+	}
+	return nil
+}
+
+// GetPostStats retrieves the snapshots of a post's stats from since on, oldest first,
+// starting with the latest snapshot at or before since.
+func (db *DB) GetPostStats(postID string, since time.Time) ([]storage.PostStats, error) {
+	return db.queryPostStats("get_post_stats.sql", postID, sql.Named("post_id", postID), sql.Named("since", since.UTC()))
+}
+
+// GetPostStatsByAuthor retrieves the snapshots of the stats of an author's posts from since on, ordered by post and
+// oldest first, starting with the latest snapshot of each post at or before since.
+func (db *DB) GetPostStatsByAuthor(authorID string, since time.Time) ([]storage.PostStats, error) {
+	return db.queryPostStats("get_post_stats_by_author.sql", authorID, sql.Named("author_id", authorID), sql.Named("since", since.UTC()))
+}
+
+// queryPostStats runs a query selecting rows of the post_stats table for a post or author.
+func (db *DB) queryPostStats(name, subject string, args ...any) ([]storage.PostStats, error) {
+	query, err := getQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post stats for %s: %w", subject, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+
+	var stats []storage.PostStats
+	for rows.Next() {
+		var s storage.PostStats
+		if err := rows.Scan(&s.PostID, &s.AuthorID, &s.ObservedAt, &s.PlayCount, &s.DiggCount, &s.CommentCount,
+			&s.ShareCount, &s.CollectCount, &s.DownloadCount); err != nil {
+			return nil, fmt.Errorf("failed to scan post stats row: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for post stats of %s: %w", subject, err)
+	}
+	return stats, nil
+}
+
+// GetUserStats retrieves the snapshots of a creator's stats from since on, oldest first,
+// starting with the latest snapshot at or before since.
+func (db *DB) GetUserStats(authorID string, since time.Time) ([]storage.UserStats, error) {
+	query, err := getQuery("get_user_stats.sql")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn.Query(query, sql.Named("author_id", authorID), sql.Named("since", since.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stats of user %s: %w", authorID, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+
+	var stats []storage.UserStats
+	for rows.Next() {
+		var s storage.UserStats
+		if err := rows.Scan(&s.AuthorID, &s.ObservedAt, &s.FollowerCount, &s.FollowingCount, &s.HeartCount,
+			&s.VideoCount, &s.DiggCount); err != nil {
+			return nil, fmt.Errorf("failed to scan user stats row: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for stats of user %s: %w", authorID, err)
+	}
+	return stats, nil
+}
+
+// GetPostAssets retrieves the downloaded assets of a post, including the photos of an album.
+func (db *DB) GetPostAssets(postID string) ([]storage.PostAsset, error) {
+	query, err := getQuery("get_post_assets.sql")
+	if err != nil {
+		return nil, err
+	}
+	// Album photos are recorded as "<post ID>_<photo>_<photos>".
+	rows, err := db.Conn.Query(query, postID, postID+`\_%`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query assets of post %s: %w", postID, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v", err)
+		}
+	}()
+
+	var assets []storage.PostAsset
+	for rows.Next() {
+		var id string
+		var downloadedAt sql.NullTime
+		var has [7]bool
+		var sha [7]sql.NullString
+		if err := rows.Scan(&id, &downloadedAt, &has[0], &sha[0], &has[1], &sha[1], &has[2], &sha[2], &has[3], &sha[3],
+			&has[4], &sha[4], &has[5], &sha[5], &has[6], &sha[6]); err != nil {
+			return nil, fmt.Errorf("failed to scan asset row: %w", err)
+		}
+		types := []tikwm.AssetType{tikwm.AssetSource, tikwm.AssetHD, tikwm.AssetSD, tikwm.AssetWatermarked,
+			tikwm.AssetCoverMedium, tikwm.AssetCoverOrigin, tikwm.AssetCoverDynamic}
+		if id != postID {
+			types[1] = tikwm.AssetAlbumPhoto // Album photos are recorded in the HD columns.
+		}
+		for i, assetType := range types {
+			if has[i] {
+				assets = append(assets, storage.PostAsset{ID: id, Type: assetType, SHA256: sha[i].String, DownloadedAt: downloadedAt.Time})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration for post %s: %w", postID, err)
+	}
+	return assets, nil
+}
+
 // GetPostsByAuthor retrieves all post records for a given author from the database.
 func (db *DB) GetPostsByAuthor(authorID string) ([]storage.PostRecord, error) {
 	query, err := getQuery("get_posts_by_author.sql")
@@ -239,7 +979,7 @@ func (db *DB) GetPostsByAuthor(authorID string) ([]storage.PostRecord, error) {
 	var posts []storage.PostRecord
 	for rows.Next() {
 		var p storage.PostRecord
-		if err := rows.Scan(&p.ID, &p.AuthorID, &p.CreateTime, &p.HasCover); err != nil {
+		if err := rows.Scan(&p.ID, &p.AuthorID, &p.CreateTime, &p.HasCover, &p.Quality); err != nil {
 			return nil, fmt.Errorf("failed to scan post row: %w", err)
 		}
 		posts = append(posts, p)
@@ -254,10 +994,14 @@ func (db *DB) GetPostsByAuthor(authorID string) ([]storage.PostRecord, error) {
 func (db *DB) GetMissingPostsByAuthor(authorID string, assetType tikwm.AssetType) ([]storage.PostRecord, error) {
 	var hasColumn string
 	switch assetType {
+	case tikwm.AssetSource:
+		hasColumn = "has_source"
 	case tikwm.AssetHD:
 		hasColumn = "has_hd"
 	case tikwm.AssetSD:
 		hasColumn = "has_sd"
+	case tikwm.AssetWatermarked:
+		hasColumn = "has_wm"
 	default:
 		return nil, fmt.Errorf("unsupported asset type for fix: %s", assetType)
 	}
@@ -278,7 +1022,7 @@ func (db *DB) GetMissingPostsByAuthor(authorID string, assetType tikwm.AssetType
 	var posts []storage.PostRecord
 	for rows.Next() {
 		var p storage.PostRecord
-		if err := rows.Scan(&p.ID, &p.AuthorID, &p.CreateTime, &p.HasCover); err != nil {
+		if err := rows.Scan(&p.ID, &p.AuthorID, &p.CreateTime, &p.HasCover, &p.Quality); err != nil {
 			return nil, fmt.Errorf("failed to scan post row: %w", err)
 		}
 		posts = append(posts, p)
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// newTestDB opens a new database in a temporary directory, closed at the end of the test.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	return newTestDBAt(t, filepath.Join(t.TempDir(), "history.db"))
+}
+
+// newTestDBAt opens the database at path, closed at the end of the test.
+func newTestDBAt(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// cachedFeedTitles returns the titles of the posts of a cached feed, in the order they are listed.
+func cachedFeedTitles(t *testing.T, db *DB, feed string) []string {
+	t.Helper()
+	cached, err := db.GetCachedFeed(feed)
+	if err != nil {
+		t.Fatalf("GetCachedFeed: %v", err)
+	}
+	if cached == nil {
+		t.Fatalf("feed %s is not cached", feed)
+	}
+	var titles []string
+	for _, post := range cached.Posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func TestCachedFeedOrdering(t *testing.T) {
+	db := newTestDB(t)
+	post := func(id, title string) tikwm.Post { return tikwm.Post{Id: id, Title: title} }
+
+	if cached, err := db.GetCachedFeed("user"); err != nil || cached != nil {
+		t.Fatalf("GetCachedFeed of an uncached feed = %v, %v; want nil, nil", cached, err)
+	}
+
+	if err := db.ReplaceCachedFeed("user", []tikwm.Post{post("3", "three"), post("2", "two"), post("1", "one")}); err != nil {
+		t.Fatalf("ReplaceCachedFeed: %v", err)
+	}
+	if got, want := cachedFeedTitles(t, db, "user"), []string{"three", "two", "one"}; !slices.Equal(got, want) {
+		t.Fatalf("after replace: got %v, want %v", got, want)
+	}
+	replaced, _ := db.GetCachedFeed("user")
+	if replaced.FullScanAt.IsZero() {
+		t.Errorf("ReplaceCachedFeed did not record a full scan")
+	}
+
+	// New posts go above the cached ones, and posts already cached keep their position but are updated.
+	if err := db.MergeCachedFeed("user", []tikwm.Post{post("5", "five"), post("4", "four"), post("3", "three, edited")}); err != nil {
+		t.Fatalf("MergeCachedFeed: %v", err)
+	}
+	if got, want := cachedFeedTitles(t, db, "user"), []string{"five", "four", "three, edited", "two", "one"}; !slices.Equal(got, want) {
+		t.Fatalf("after merge: got %v, want %v", got, want)
+	}
+	merged, _ := db.GetCachedFeed("user")
+	if !merged.FullScanAt.Equal(replaced.FullScanAt) {
+		t.Errorf("MergeCachedFeed changed the full scan time from %v to %v", replaced.FullScanAt, merged.FullScanAt)
+	}
+
+	// A second merge stacks on top of the first one.
+	if err := db.MergeCachedFeed("user", []tikwm.Post{post("6", "six")}); err != nil {
+		t.Fatalf("MergeCachedFeed: %v", err)
+	}
+	if got, want := cachedFeedTitles(t, db, "user"), []string{"six", "five", "four", "three, edited", "two", "one"}; !slices.Equal(got, want) {
+		t.Fatalf("after second merge: got %v, want %v", got, want)
+	}
+
+	// A full scan drops the posts that are gone, and other feeds are left alone.
+	if err := db.ReplaceCachedFeed("#tag", []tikwm.Post{post("1", "one")}); err != nil {
+		t.Fatalf("ReplaceCachedFeed: %v", err)
+	}
+	if err := db.ReplaceCachedFeed("user", []tikwm.Post{post("6", "six"), post("2", "two")}); err != nil {
+		t.Fatalf("ReplaceCachedFeed: %v", err)
+	}
+	if got, want := cachedFeedTitles(t, db, "user"), []string{"six", "two"}; !slices.Equal(got, want) {
+		t.Errorf("after second replace: got %v, want %v", got, want)
+	}
+	if got, want := cachedFeedTitles(t, db, "#tag"), []string{"one"}; !slices.Equal(got, want) {
+		t.Errorf("other feed: got %v, want %v", got, want)
+	}
+}
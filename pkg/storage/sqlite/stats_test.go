@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+func TestPostStatsSkipsUnchangedSnapshots(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	post := func(id string, plays int) tikwm.Post {
+		p := tikwm.Post{Id: id, PlayCount: plays}
+		p.Author.UniqueId = "creator"
+		return p
+	}
+	// Each snapshot is taken an hour after the previous one.
+	snapshots := [][]tikwm.Post{
+		{post("1", 10), post("2", 5)},
+		{post("1", 10), post("2", 6)}, // Post 1 did not change.
+		{post("1", 20), post("2", 6)}, // Post 2 did not change.
+		{post("1", 10)},               // Back to an earlier value, which is still a change.
+	}
+	for i, posts := range snapshots {
+		if err := db.AddPostStats(posts, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("AddPostStats %d: %v", i, err)
+		}
+	}
+
+	// plays returns the play counts of stats, and the hours after start they were observed at.
+	plays := func(stats []storage.PostStats) (counts []int, hours []int) {
+		for _, s := range stats {
+			counts = append(counts, s.PlayCount)
+			hours = append(hours, int(s.ObservedAt.Sub(start).Hours()))
+		}
+		return counts, hours
+	}
+	tests := []struct {
+		name       string
+		postID     string
+		since      time.Time
+		wantCounts []int
+		wantHours  []int
+	}{
+		{"all of post 1", "1", start, []int{10, 20, 10}, []int{0, 2, 3}},
+		{"all of post 2", "2", start, []int{5, 6}, []int{0, 1}},
+		{"since between snapshots", "1", start.Add(90 * time.Minute), []int{10, 20, 10}, []int{0, 2, 3}},
+		{"since a snapshot", "1", start.Add(2 * time.Hour), []int{20, 10}, []int{2, 3}},
+		{"since after the last snapshot", "2", start.Add(10 * time.Hour), []int{6}, []int{1}},
+		{"since before the first snapshot", "2", start.Add(-time.Hour), []int{5, 6}, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := db.GetPostStats(tt.postID, tt.since)
+			if err != nil {
+				t.Fatalf("GetPostStats: %v", err)
+			}
+			counts, hours := plays(stats)
+			if !slices.Equal(counts, tt.wantCounts) || !slices.Equal(hours, tt.wantHours) {
+				t.Errorf("play counts %v at hours %v, want %v at hours %v", counts, hours, tt.wantCounts, tt.wantHours)
+			}
+		})
+	}
+
+	byAuthor, err := db.GetPostStatsByAuthor("creator", start)
+	if err != nil {
+		t.Fatalf("GetPostStatsByAuthor: %v", err)
+	}
+	if len(byAuthor) != 5 {
+		t.Errorf("GetPostStatsByAuthor returned %d snapshots, want 5", len(byAuthor))
+	}
+}
+
+func TestUserStatsSkipsUnchangedSnapshots(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	user := &tikwm.UserDetail{}
+	user.User.UniqueId = "creator"
+	for i, followers := range []int{100, 100, 150, 150} {
+		user.Stats.FollowerCount = followers
+		if err := db.AddUserStats(user, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("AddUserStats %d: %v", i, err)
+		}
+	}
+
+	stats, err := db.GetUserStats("creator", start.Add(90*time.Minute))
+	if err != nil {
+		t.Fatalf("GetUserStats: %v", err)
+	}
+	var followers []int
+	for _, s := range stats {
+		followers = append(followers, s.FollowerCount)
+	}
+	if want := []int{100, 150}; !slices.Equal(followers, want) {
+		t.Errorf("follower counts %v, want %v", followers, want)
+	}
+	if len(stats) == 2 && !stats[0].ObservedAt.Equal(start) {
+		t.Errorf("first snapshot observed at %v, want %v", stats[0].ObservedAt, start)
+	}
+}
@@ -1,7 +1,22 @@
 package storage
 
 import (
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
+	"encoding/json"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// Source types recorded by AddPostSource.
+const (
+	// SourceHashtag marks a post found through a hashtag (challenge) feed.
+	SourceHashtag = "hashtag"
+	// SourceSearch marks a post found through a keyword search.
+	SourceSearch = "search"
+	// SourcePlaylist marks a post found through a creator's playlist (mix).
+	SourcePlaylist = "playlist"
+	// SourceCollection marks a post found through a collection.
+	SourceCollection = "collection"
 )
 
 // PostRecord represents a single row from the posts table.
@@ -14,10 +29,165 @@ type PostRecord struct {
 	CreateTime int64
 	// HasCover indicates whether the post has a cover image.
 	HasCover bool
+	// Quality is the rung of the quality ladder the post's video was downloaded in,
+	// or "" if it was not downloaded with a ladder.
+	Quality tikwm.AssetType
+}
+
+// PostAsset is a downloaded asset of a post, as recorded in the database.
+type PostAsset struct {
+	// ID is the ID the asset is recorded under: the post ID, or "<post ID>_<photo>_<photos>" for album photos.
+	ID string
+	// Type is the type of the asset.
+	Type tikwm.AssetType
+	// SHA256 is the hash of the downloaded file.
+	SHA256 string
+	// DownloadedAt is when an asset recorded under ID was last downloaded.
+	DownloadedAt time.Time
+}
+
+// Post kinds accepted by PostFilter.Kind.
+const (
+	// PostKindVideo selects video posts.
+	PostKindVideo = "video"
+	// PostKindAlbum selects album (photo) posts.
+	PostKindAlbum = "album"
+)
+
+// PostMetadata is the metadata of a downloaded post, as recorded by SavePostMetadata.
+type PostMetadata struct {
+	// ID is the unique identifier for the post.
+	ID string
+	// AuthorID is the identifier of the post's author.
+	AuthorID string
+	// CreateTime is the post's creation timestamp in Unix epoch seconds.
+	CreateTime int64
+	// Title is the title (caption) of the post.
+	Title string
+	// Duration is the duration of the video in seconds, or 0 for albums.
+	Duration int
+	// Region is the region the post was created in.
+	Region string
+	// MusicID is the ID of the music used in the post, or "" if unknown.
+	MusicID string
+	// IsAd indicates whether the post is an advertisement.
+	IsAd bool
+	// ImageCount is the number of photos of an album, or 0 for videos.
+	ImageCount int
+	// Raw is the post as returned by the API.
+	Raw json.RawMessage
+	// UpdatedAt is when the metadata was last saved.
+	UpdatedAt time.Time
+}
+
+// PostFilter selects the posts returned by FindPosts. Zero fields select every post.
+type PostFilter struct {
+	// AuthorID selects the posts of an author.
+	AuthorID string
+	// Since selects the posts created at or after a time.
+	Since time.Time
+	// Until selects the posts created before a time.
+	Until time.Time
+	// MinDuration selects the videos that last at least this many seconds.
+	MinDuration int
+	// MaxDuration selects the videos that last at most this many seconds.
+	MaxDuration int
+	// Region selects the posts created in a region.
+	Region string
+	// MusicID selects the posts that use a music track.
+	MusicID string
+	// Title selects the posts whose title contains a string, ignoring case.
+	Title string
+	// Kind selects videos (PostKindVideo) or albums (PostKindAlbum).
+	Kind string
+	// ExcludeAds leaves out advertisements.
+	ExcludeAds bool
+	// Limit is the maximum number of posts returned.
+	Limit int
+}
+
+// PostStats is a snapshot of the engagement stats of a post, as recorded by AddPostStats.
+type PostStats struct {
+	// PostID is the unique identifier for the post.
+	PostID string
+	// AuthorID is the identifier of the post's author.
+	AuthorID string
+	// ObservedAt is when the stats were fetched.
+	ObservedAt time.Time
+	// PlayCount is the number of times the post was played.
+	PlayCount int
+	// DiggCount is the number of likes of the post.
+	DiggCount int
+	// CommentCount is the number of comments on the post.
+	CommentCount int
+	// ShareCount is the number of times the post was shared.
+	ShareCount int
+	// CollectCount is the number of times the post was saved to a collection.
+	CollectCount int
+	// DownloadCount is the number of times the post was downloaded.
+	DownloadCount int
+}
+
+// UserStats is a snapshot of the stats of a creator, as recorded by AddUserStats.
+type UserStats struct {
+	// AuthorID is the identifier (unique ID) of the creator.
+	AuthorID string
+	// ObservedAt is when the stats were fetched.
+	ObservedAt time.Time
+	// FollowerCount is the number of followers of the creator.
+	FollowerCount int
+	// FollowingCount is the number of users the creator follows.
+	FollowingCount int
+	// HeartCount is the number of likes the creator's posts received.
+	HeartCount int
+	// VideoCount is the number of posts of the creator.
+	VideoCount int
+	// DiggCount is the number of posts the creator liked.
+	DiggCount int
+}
+
+// FeedCheckpoint records how far an interrupted feed crawl got, so that it can be resumed.
+type FeedCheckpoint struct {
+	// Target is the feed the checkpoint belongs to, e.g. a username or a "#"-prefixed hashtag.
+	Target string
+	// Cursor is the cursor of the page containing the last processed post.
+	Cursor string
+	// PostID is the ID of the last processed post.
+	PostID string
+	// Order is the feed order ("oldest" or "newest") the crawl was processed in.
+	Order string
+	// UpdatedAt is when the checkpoint was last saved.
+	UpdatedAt time.Time
+}
+
+// CachedFeed is the cached listing of a feed.
+type CachedFeed struct {
+	// Feed is the key of the feed, e.g. a username or a "#"-prefixed hashtag.
+	Feed string
+	// Posts are the cached posts of the feed, newest first.
+	Posts []tikwm.Post
+	// SyncedAt is when the cache was last updated from the API.
+	SyncedAt time.Time
+	// FullScanAt is when the whole feed was last paged through. It is zero if it never was.
+	FullScanAt time.Time
+}
+
+// SourceTask is a submitted source encode task, persisted so that its result can be collected after a restart.
+type SourceTask struct {
+	// VideoID is the ID of the video being encoded.
+	VideoID string
+	// TaskID is the ID of the task returned by the API.
+	TaskID string
+	// SubmittedAt is when the task was submitted.
+	SubmittedAt time.Time
+	// Result is the result of the task, or nil while it is still pending.
+	Result *tikwm.SourceEncodeResult
 }
 
 // Storer defines the interface for database operations.
 // This allows for different database backends to be used with the client.
+// Features added over time are stored through the optional interfaces below; the client checks whether the database
+// implements each of them and goes without the feature when it does not, so a Storer does not have to implement them.
 type Storer interface {
 	// AddOrUpdateAsset adds or updates a generic asset record for a post.
 	AddOrUpdateAsset(postID, authorID string, createTime int64, assetType tikwm.AssetType, sha256 string) error
@@ -38,3 +208,91 @@ type Storer interface {
 	// Close closes the database connection.
 	Close() error
 }
+
+// MusicStore is implemented by databases that record the music used by posts. Without it, music is not downloaded.
+type MusicStore interface {
+	// AddOrUpdateMusic adds or updates a music record and marks the given music asset as downloaded.
+	AddOrUpdateMusic(music *tikwm.MusicInfo, assetType tikwm.AssetType, sha256 string) error
+	// MusicExists checks if a specific asset for a music ID exists in the database.
+	MusicExists(musicID string, assetType tikwm.AssetType) (bool, error)
+	// LinkPostMusic records that a post uses a music track.
+	LinkPostMusic(postID, musicID string) error
+}
+
+// PostSourceStore is implemented by databases that record the feeds other than their authors' profiles
+// that posts were found through.
+type PostSourceStore interface {
+	// AddPostSource records that a post was found through a feed other than its author's profile, such as a hashtag.
+	AddPostSource(postID, sourceType, source string) error
+}
+
+// CheckpointStore is implemented by databases that keep feed checkpoints. Without it, interrupted crawls
+// start over.
+type CheckpointStore interface {
+	// GetFeedCheckpoint retrieves the checkpoint of a feed. It returns nil if the feed has no checkpoint.
+	GetFeedCheckpoint(target string) (*FeedCheckpoint, error)
+	// SaveFeedCheckpoint adds or replaces the checkpoint of a feed.
+	SaveFeedCheckpoint(checkpoint *FeedCheckpoint) error
+	// DeleteFeedCheckpoint deletes the checkpoint of a feed, if any.
+	DeleteFeedCheckpoint(target string) error
+}
+
+// FeedCacheStore is implemented by databases that cache feed listings. Without it, feeds are not cached.
+type FeedCacheStore interface {
+	// GetCachedFeed retrieves the cached listing of a feed. It returns nil if the feed has never been cached.
+	GetCachedFeed(feed string) (*CachedFeed, error)
+	// ReplaceCachedFeed replaces the cached listing of a feed with posts, newest first, after a full scan.
+	ReplaceCachedFeed(feed string, posts []tikwm.Post) error
+	// MergeCachedFeed adds posts, newest first, to the top of a feed's cached listing, updating posts already cached.
+	MergeCachedFeed(feed string, posts []tikwm.Post) error
+}
+
+// SourceTaskStore is implemented by databases that persist source encode tasks. Without it, the tasks pending
+// when a run stops are submitted again by the next run.
+type SourceTaskStore interface {
+	// GetSourceTasks retrieves all persisted source encode tasks.
+	GetSourceTasks() ([]SourceTask, error)
+	// SaveSourceTask adds or replaces a source encode task.
+	SaveSourceTask(task *SourceTask) error
+	// DeleteSourceTask deletes the source encode task of a video, if any.
+	DeleteSourceTask(videoID string) error
+}
+
+// QualityStore is implemented by databases that record the rung of the quality ladder that videos were downloaded
+// in. Without it, 'fix' cannot upgrade videos that fell back to a lower quality.
+type QualityStore interface {
+	// SetPostQuality records the rung of the quality ladder that a post's video was downloaded in.
+	SetPostQuality(postID string, quality tikwm.AssetType) error
+}
+
+// MetadataStore is implemented by databases that record the metadata and downloaded assets of posts.
+// Without it, post metadata sidecar files are not saved.
+type MetadataStore interface {
+	// GetPostAssets retrieves the downloaded assets of a post, including the photos of an album.
+	GetPostAssets(postID string) ([]PostAsset, error)
+	// SavePostMetadata adds or replaces the metadata of a post, such as its title, duration and API payload.
+	SavePostMetadata(post *tikwm.Post) error
+	// GetPostMetadata retrieves the metadata of a post. It returns nil if the post has no metadata.
+	GetPostMetadata(postID string) (*PostMetadata, error)
+	// FindPosts retrieves the metadata of the posts selected by filter, newest first.
+	FindPosts(filter PostFilter) ([]PostMetadata, error)
+}
+
+// StatsStore is implemented by databases that keep the history of the engagement stats of posts and creators.
+type StatsStore interface {
+	// AddPostStats records a snapshot of the stats of posts, fetched at a time. Posts whose stats did not change
+	// since their latest snapshot are skipped.
+	AddPostStats(posts []tikwm.Post, at time.Time) error
+	// AddUserStats records a snapshot of the stats of a creator, fetched at a time, unless they did not change
+	// since the creator's latest snapshot.
+	AddUserStats(user *tikwm.UserDetail, at time.Time) error
+	// GetPostStats retrieves the snapshots of a post's stats from since on, oldest first, starting with the latest
+	// snapshot at or before since.
+	GetPostStats(postID string, since time.Time) ([]PostStats, error)
+	// GetPostStatsByAuthor retrieves the snapshots of the stats of an author's posts from since on, ordered by post
+	// and oldest first, starting with the latest snapshot of each post at or before since.
+	GetPostStatsByAuthor(authorID string, since time.Time) ([]PostStats, error)
+	// GetUserStats retrieves the snapshots of a creator's stats from since on, oldest first, starting with the
+	// latest snapshot at or before since.
+	GetUserStats(authorID string, since time.Time) ([]UserStats, error)
+}
@@ -0,0 +1,318 @@
+// Package tikwm provides the types and endpoint calls for the tikwm.com API.
+// It is the same surface used by pkg/client and the tikwm CLI.
+package tikwm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/ratelimiter"
+)
+
+// Rate limit budgets, each covering one kind of API endpoint.
+const (
+	// BudgetFeed covers feed paging: profiles, hashtags, playlists, collections, searches and comments.
+	BudgetFeed = "feed"
+	// BudgetPost covers single post, profile and hashtag lookups.
+	BudgetPost = "post"
+	// BudgetSource covers source encode submission and polling.
+	BudgetSource = "source"
+)
+
+var (
+	// URL is the base URL for the tikwm API.
+	URL string = "https://tikwm.com/api"
+	// APIKeyHeader is the HTTP header API keys are sent in. Keys are set up with network.InitKeys.
+	APIKeyHeader = "X-Api-Key"
+	// RequestDelay is the delay between API requests to avoid rate-limiting.
+	RequestDelay time.Duration = 1250 * time.Millisecond
+	// AdaptiveRateLimit slows all API requests down when tikwm starts rate-limiting them, and speeds them
+	// back up toward RequestDelay once requests succeed again.
+	AdaptiveRateLimit = true
+	// MaxRequestDelay is the longest delay between API requests that AdaptiveRateLimit slows down to.
+	MaxRequestDelay time.Duration = 20 * time.Second
+	// OnRequestDelayChange, if set, is called with the previous and the new delay between API requests
+	// whenever AdaptiveRateLimit changes it.
+	OnRequestDelayChange func(previous, delay time.Duration)
+	// RequestBurst is the number of API requests that may be sent back to back after a pause.
+	RequestBurst int = 1
+	// RateLimitStateFile is the path of a state file through which the rate limit is shared with other
+	// processes using the same file. If empty, the rate limit only applies to this process.
+	RateLimitStateFile string
+	// BudgetDelays sets the minimum delay between requests of a budget (BudgetFeed, BudgetPost or BudgetSource),
+	// on top of RequestDelay. Budgets without a delay are only limited by RequestDelay.
+	BudgetDelays = map[string]time.Duration{}
+	// MaxUserFeedCount is the number of posts to fetch per user feed request.
+	MaxUserFeedCount int = 34
+	// MaxCommentCount is the number of comments to fetch per comment list request.
+	MaxCommentCount int = 50
+	// Debug enables verbose logging of API responses.
+	Debug = false
+	// DefaultBackend is the backend used by the package-level endpoint functions.
+	DefaultBackend Backend = &HTTPBackend{}
+
+	// apiRateLimiter is the global rate limiter for all API requests.
+	apiRateLimiter     *ratelimiter.Group
+	adaptiveLimiter    *ratelimiter.Adaptive
+	initRateLimiterMux sync.Mutex
+	stopOnCtxDone      func() bool
+)
+
+// endpointBudgets maps API endpoints to their rate limit budgets. Endpoints not listed use BudgetPost.
+var endpointBudgets = map[string]string{
+	"user/posts":        BudgetFeed,
+	"challenge/posts":   BudgetFeed,
+	"mix/posts":         BudgetFeed,
+	"collection/posts":  BudgetFeed,
+	"feed/search":       BudgetFeed,
+	"comment/list":      BudgetFeed,
+	"comment/reply":     BudgetFeed,
+	"video/task/submit": BudgetSource,
+	"video/task/result": BudgetSource,
+}
+
+// InitRateLimiter initializes the global API rate limiter from RequestDelay, RequestBurst, BudgetDelays
+// and RateLimitStateFile. This must be called once at application startup. The limiter is stopped when ctx is done.
+// If the state file cannot be used, the rate limit falls back to applying to this process only.
+func InitRateLimiter(ctx context.Context) {
+	initRateLimiterMux.Lock()
+	defer initRateLimiterMux.Unlock()
+	if apiRateLimiter == nil {
+		limiter := ratelimiter.NewGroup(ratelimiter.New(RequestDelay, RequestBurst))
+		for budget, delay := range BudgetDelays {
+			limiter.SetLimit(budget, delay, 1)
+		}
+		if RateLimitStateFile != "" {
+			shared, err := ratelimiter.NewShared(RateLimitStateFile, RequestDelay, RequestBurst)
+			if err != nil {
+				log.Printf("Could not share the rate limit with other processes, limiting this process only: %v", err)
+			} else {
+				limiter.Share(shared)
+			}
+		}
+		apiRateLimiter = limiter
+		if AdaptiveRateLimit {
+			adaptiveLimiter = ratelimiter.NewAdaptive(limiter, RequestDelay, max(MaxRequestDelay, RequestDelay), OnRequestDelayChange)
+		}
+		stopOnCtxDone = context.AfterFunc(ctx, limiter.Stop)
+	}
+}
+
+// StopRateLimiter stops the global API rate limiter, waking up every request waiting for it.
+// This must be called once at application shutdown.
+func StopRateLimiter() {
+	initRateLimiterMux.Lock()
+	defer initRateLimiterMux.Unlock()
+	if apiRateLimiter != nil {
+		stopOnCtxDone()
+		apiRateLimiter.Stop()
+		apiRateLimiter = nil
+		adaptiveLimiter = nil
+	}
+}
+
+// CurrentRequestDelay returns the delay currently enforced between API requests, which is longer than
+// RequestDelay while AdaptiveRateLimit is backing off.
+func CurrentRequestDelay() time.Duration {
+	initRateLimiterMux.Lock()
+	adaptive := adaptiveLimiter
+	initRateLimiterMux.Unlock()
+	if adaptive == nil {
+		return RequestDelay
+	}
+	return adaptive.Interval()
+}
+
+// observeResponse feeds the outcome of an API request to the adaptive rate limiter.
+// Errors that are not API responses, such as network failures, say nothing about the rate limit.
+func observeResponse(err error) {
+	initRateLimiterMux.Lock()
+	adaptive := adaptiveLimiter
+	initRateLimiterMux.Unlock()
+	if adaptive == nil {
+		return
+	}
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		adaptive.Throttled()
+	case err == nil, errors.As(err, &apiErr):
+		adaptive.Success()
+	}
+}
+
+// wait blocks until the global rate limiter and the budget of endpoint allow a request, or ctx is done.
+// The init mutex is only held while looking up the limiter, so a cancelled caller
+// never blocks behind another waiter.
+func wait(ctx context.Context, endpoint string) error {
+	initRateLimiterMux.Lock()
+	limiter := apiRateLimiter
+	initRateLimiterMux.Unlock()
+	if limiter == nil {
+		return errors.New("rate limiter not initialized, call InitRateLimiter first")
+	}
+	budget, ok := endpointBudgets[endpoint]
+	if !ok {
+		budget = BudgetPost
+	}
+	return limiter.Wait(ctx, budget)
+}
+
+// SourceEncodeResult represents the final successful result from the source encode endpoint.
+type SourceEncodeResult struct {
+	PlayURL string `json:"play_url"` // PlayURL is the URL of the encoded video.
+	Size    int    `json:"size"`     // Size is the size of the encoded video in bytes.
+}
+
+// Raw executes a raw request to the tikwm API using DefaultBackend.
+// Cancelling ctx aborts both the rate limiter wait and the in-flight HTTP request.
+func Raw(ctx context.Context, method string, query map[string]string) ([]byte, error) {
+	return DefaultBackend.Raw(ctx, method, query)
+}
+
+// RawParsed executes a raw request using DefaultBackend and parses the JSON response.
+func RawParsed[T any](ctx context.Context, method string, query map[string]string) (*T, error) {
+	data, err := DefaultBackend.Raw(ctx, method, query) // Execute the raw request.
+	if err != nil {
+		return nil, err // Return an error if the request failed.
+	}
+	return decode[T](data, method, query)
+}
+
+// decode parses the standard tikwm response envelope and returns its data field.
+func decode[T any](data []byte, method string, query map[string]string) (*T, error) {
+	var resp struct {
+		Code          int     `json:"code"`           // Code is the response code.
+		Msg           string  `json:"msg"`            // Msg is the response message.
+		ProcessedTime float64 `json:"processed_time"` // ProcessedTime is the time it took to process the request.
+		Data          *T      `json:"data"`           // Data is the response data.
+	}
+	if err := json.Unmarshal(data, &resp); err != nil { // Unmarshal the response body.
+		// Attempt to unmarshal just the error part for better diagnostics on malformed success responses
+		var errResp struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.Unmarshal(data, &errResp) == nil && errResp.Code != 0 {
+			return nil, &APIError{Code: errResp.Code, Msg: errResp.Msg, Endpoint: method, HTTPStatus: http.StatusOK}
+		}
+		return nil, fmt.Errorf("failed to unmarshal tikwm response: %w. raw: %s", err, string(data))
+	}
+	if resp.Code != 0 { // Check if the response code is not 0.
+		queryStr := "???"                                // Default query string.
+		if buf, err := json.Marshal(query); err == nil { // Marshal the query parameters.
+			queryStr = string(buf) // Convert the query parameters to a string.
+		}
+		return nil, &APIError{Code: resp.Code, Msg: resp.Msg, Endpoint: method, HTTPStatus: http.StatusOK, Query: queryStr} // Return an error if the response code is not 0.
+	}
+	return resp.Data, nil // Return the response data.
+}
+
+// AwaitSourceEncode polls b until the source encode task finishes, fails or times out.
+// Cancelling ctx stops the polling loop immediately.
+func AwaitSourceEncode(ctx context.Context, b Backend, taskID string) (*SourceEncodeResult, error) {
+	for i := 0; i < 60; i++ { // Poll for up to 60 seconds.
+		// Each poll is a separate, rate-limited request.
+		result, done, err := b.PollSourceEncode(ctx, taskID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errors.Is(err, ErrDailyQuota) || errors.Is(err, ErrSourceEncodeFailed) {
+				return nil, err // Propagate the error to be handled by the caller.
+			}
+			if errors.Is(err, ErrRateLimited) && !AdaptiveRateLimit {
+				if err := sleepCtx(ctx, 2*time.Second); err != nil { // Wait a bit longer if rate limited during polling
+					return nil, err
+				}
+			}
+			continue // Ignore transient errors and retry
+		}
+		if done {
+			return result, nil // Return the source encoding result.
+		}
+		// Status is still pending, continue polling.
+		// A small sleep is good practice to not hammer the API, even with rate limiting.
+		if err := sleepCtx(ctx, 1*time.Second); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("source encode task timed out") // Return an error if the source encoding task timed out.
+}
+
+// sleepCtx pauses for d, returning early with ctx's error if it is cancelled.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetSourceEncode gets the highest quality "source" video link using DefaultBackend.
+func GetSourceEncode(ctx context.Context, videoID string) (*SourceEncodeResult, error) {
+	taskID, err := DefaultBackend.SubmitSourceEncode(ctx, videoID) // Submit the source encoding task.
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit source encode task: %w", err) // Return an error if the source encoding task could not be submitted.
+	}
+	return AwaitSourceEncode(ctx, DefaultBackend, taskID) // Poll for the source encoding result.
+}
+
+// GetPost fetches a single post by URL or ID using DefaultBackend.
+func GetPost(ctx context.Context, url string, hd ...bool) (*Post, error) {
+	return DefaultBackend.GetPost(ctx, url, len(hd) == 0 || hd[0])
+}
+
+// GetUserFeedRaw fetches a raw page of a user's feed using DefaultBackend.
+func GetUserFeedRaw(ctx context.Context, uniqueID string, count int, cursor string) (*UserFeed, error) {
+	return DefaultBackend.GetUserFeed(ctx, uniqueID, count, cursor)
+}
+
+// GetUserDetail fetches details for a user profile using DefaultBackend.
+func GetUserDetail(ctx context.Context, uniqueID string) (*UserDetail, error) {
+	return DefaultBackend.GetUserDetail(ctx, uniqueID)
+}
+
+// GetChallengeInfo fetches details for a hashtag (challenge) using DefaultBackend.
+func GetChallengeInfo(ctx context.Context, name string) (*ChallengeInfo, error) {
+	return DefaultBackend.GetChallengeInfo(ctx, name)
+}
+
+// GetChallengeFeedRaw fetches a raw page of a hashtag's feed using DefaultBackend.
+func GetChallengeFeedRaw(ctx context.Context, challengeID string, count int, cursor string) (*UserFeed, error) {
+	return DefaultBackend.GetChallengeFeed(ctx, challengeID, count, cursor)
+}
+
+// GetCommentsRaw fetches a raw page of a post's comments using DefaultBackend.
+func GetCommentsRaw(ctx context.Context, postID string, count int, cursor string) (*CommentPage, error) {
+	return DefaultBackend.GetComments(ctx, postID, count, cursor)
+}
+
+// GetCommentRepliesRaw fetches a raw page of replies to a comment using DefaultBackend.
+func GetCommentRepliesRaw(ctx context.Context, commentID string, count int, cursor string) (*CommentPage, error) {
+	return DefaultBackend.GetCommentReplies(ctx, commentID, count, cursor)
+}
+
+// SearchPostsRaw fetches a raw page of the search feed for keywords using DefaultBackend.
+func SearchPostsRaw(ctx context.Context, keywords string, count int, cursor string) (*UserFeed, error) {
+	return DefaultBackend.SearchPosts(ctx, keywords, count, cursor)
+}
+
+// GetMixFeedRaw fetches a raw page of a playlist (mix) using DefaultBackend.
+func GetMixFeedRaw(ctx context.Context, mixID string, count int, cursor string) (*UserFeed, error) {
+	return DefaultBackend.GetMixFeed(ctx, mixID, count, cursor)
+}
+
+// GetCollectionFeedRaw fetches a raw page of a collection using DefaultBackend.
+func GetCollectionFeedRaw(ctx context.Context, collectionID string, count int, cursor string) (*UserFeed, error) {
+	return DefaultBackend.GetCollectionFeed(ctx, collectionID, count, cursor)
+}
@@ -0,0 +1,332 @@
+package tikwm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/network"
+)
+
+// Backend is the set of tikwm endpoints used by pkg/client.
+// HTTPBackend talks to tikwm.com; tests can point it at tikwmtest.Server or provide their own implementation.
+type Backend interface {
+	// GetPost fetches a single post by URL or ID.
+	GetPost(ctx context.Context, url string, hd bool) (*Post, error)
+	// GetUserFeed fetches one page of a user's feed starting at cursor.
+	GetUserFeed(ctx context.Context, uniqueID string, count int, cursor string) (*UserFeed, error)
+	// GetUserDetail fetches details for a user profile.
+	GetUserDetail(ctx context.Context, uniqueID string) (*UserDetail, error)
+	// GetChallengeInfo fetches details for a hashtag (challenge) by name.
+	GetChallengeInfo(ctx context.Context, name string) (*ChallengeInfo, error)
+	// GetChallengeFeed fetches one page of a hashtag's feed starting at cursor.
+	GetChallengeFeed(ctx context.Context, challengeID string, count int, cursor string) (*UserFeed, error)
+	// GetMixFeed fetches one page of a playlist (mix) starting at cursor, in playlist order.
+	GetMixFeed(ctx context.Context, mixID string, count int, cursor string) (*UserFeed, error)
+	// GetCollectionFeed fetches one page of a collection starting at cursor, in collection order.
+	GetCollectionFeed(ctx context.Context, collectionID string, count int, cursor string) (*UserFeed, error)
+	// SearchPosts fetches one page of the search feed for keywords starting at cursor.
+	SearchPosts(ctx context.Context, keywords string, count int, cursor string) (*UserFeed, error)
+	// GetComments fetches one page of a post's comments starting at cursor.
+	GetComments(ctx context.Context, postID string, count int, cursor string) (*CommentPage, error)
+	// GetCommentReplies fetches one page of replies to a comment starting at cursor.
+	GetCommentReplies(ctx context.Context, commentID string, count int, cursor string) (*CommentPage, error)
+	// SubmitSourceEncode submits a video for source encoding and returns the task ID.
+	SubmitSourceEncode(ctx context.Context, videoID string) (string, error)
+	// PollSourceEncode checks a source encode task once.
+	// It returns done=false while the task is still pending and ErrSourceEncodeFailed if it failed.
+	PollSourceEncode(ctx context.Context, taskID string) (result *SourceEncodeResult, done bool, err error)
+	// Raw sends a request to an API endpoint and returns the response body as is, for endpoints the other
+	// methods do not cover.
+	Raw(ctx context.Context, method string, query map[string]string) ([]byte, error)
+}
+
+// Ensure that HTTPBackend implements the Backend interface.
+var _ Backend = (*HTTPBackend)(nil)
+
+// HTTPBackend is the default Backend, which sends rate-limited HTTP requests to the tikwm API.
+type HTTPBackend struct {
+	// URL is the base URL of the API. If empty, the package-level URL is used.
+	URL string
+	// Client is the HTTP client used for requests. If nil, http.DefaultClient is used
+	// so that transports installed by pkg/network are respected.
+	Client *http.Client
+}
+
+// NewHTTPBackend creates an HTTPBackend for the API at baseURL.
+func NewHTTPBackend(baseURL string) *HTTPBackend {
+	return &HTTPBackend{URL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// baseURL returns the configured base URL, falling back to the package-level URL.
+func (b *HTTPBackend) baseURL() string {
+	if b.URL != "" {
+		return b.URL
+	}
+	return URL
+}
+
+// httpClient returns the configured HTTP client, falling back to http.DefaultClient.
+func (b *HTTPBackend) httpClient() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	return http.DefaultClient
+}
+
+// Raw executes a raw GET request against the API and returns the response body.
+// Cancelling ctx aborts both the rate limiter wait and the in-flight HTTP request.
+func (b *HTTPBackend) Raw(ctx context.Context, method string, query map[string]string) ([]byte, error) {
+	data, key, err := b.raw(ctx, method, query)
+	// The body is returned as is, but its envelope still reports rate and daily limits.
+	outcome := err
+	if err == nil {
+		_, outcome = decode[json.RawMessage](data, method, query)
+	}
+	checkKeyQuota(key, outcome)
+	observeResponse(outcome)
+	return data, err
+}
+
+// raw executes a raw GET request like Raw, and also returns the API key the request was sent with, if any.
+func (b *HTTPBackend) raw(ctx context.Context, method string, query map[string]string) ([]byte, string, error) {
+	if err := wait(ctx, method); err != nil {
+		return nil, "", fmt.Errorf("rate limiter stopped: %w", err)
+	}
+
+	urlPath := fmt.Sprintf("%s/%s", b.baseURL(), method)                                            // Construct the full URL.
+	req, err := http.NewRequestWithContext(withEndpoint(ctx, method), http.MethodGet, urlPath, nil) // Create a new HTTP request.
+	if err != nil {
+		return nil, "", err // Return an error if the request could not be created.
+	}
+	q := req.URL.Query()           // Get the query parameters.
+	for name, val := range query { // Iterate over the query parameters.
+		q.Add(name, val) // Add the query parameter to the URL.
+	}
+	req.URL.RawQuery = q.Encode() // Encode the query parameters.
+	resp, key, err := b.send(req) // Execute the HTTP request.
+	if err != nil {
+		return nil, key, err // Return an error if the request failed.
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil { // Close the response body.
+			log.Printf("error closing response body: %v", err) // Log any errors that occur while closing the response body.
+		}
+	}()
+	buffer, err := io.ReadAll(resp.Body) // Read the response body.
+	if err != nil {
+		return nil, key, err // Return an error if the response body could not be read.
+	}
+	if Debug {
+		log.Print(string(buffer)) // Log the response body if debugging is enabled.
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{Endpoint: method, HTTPStatus: resp.StatusCode}
+		var errResp struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.Unmarshal(buffer, &errResp) == nil {
+			apiErr.Code, apiErr.Msg = errResp.Code, errResp.Msg
+		}
+		return nil, key, apiErr
+	}
+	return buffer, key, nil // Return the response body.
+}
+
+// send attaches the next API key, if any, to req and sends it. It returns the response and the key the request
+// was sent with, and counts the request against the daily quota of the key or of the address it was sent from.
+func (b *HTTPBackend) send(req *http.Request) (*http.Response, string, error) {
+	if err := network.CheckQuota(); err != nil {
+		return nil, "", err
+	}
+	key, err := network.NextAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	// Requests that never got a connection, e.g. replayed ones, did not reach the API.
+	var local net.Addr
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { local = info.Conn.LocalAddr() }}
+	resp, err := b.httpClient().Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if local != nil {
+		network.CountRequest(key, local)
+	}
+	return resp, key, err
+}
+
+// checkKeyQuota marks key as exhausted if err reports the daily limit, so that later requests use the next key.
+func checkKeyQuota(key string, err error) {
+	if key != "" && errors.Is(err, ErrDailyQuota) {
+		network.MarkAPIKeyAsExhausted(key)
+	}
+}
+
+// rawParsed executes a request against b and parses the JSON response.
+func rawParsed[T any](ctx context.Context, b *HTTPBackend, method string, query map[string]string) (*T, error) {
+	data, key, err := b.raw(ctx, method, query)
+	var result *T
+	if err == nil {
+		result, err = decode[T](data, method, query)
+	}
+	checkKeyQuota(key, err)
+	observeResponse(err)
+	return result, err
+}
+
+// GetPost fetches a single post by URL or ID.
+func (b *HTTPBackend) GetPost(ctx context.Context, url string, hd bool) (*Post, error) {
+	query := map[string]string{"url": url} // Construct the query parameters.
+	if hd {
+		query["hd"] = "1" // Set the hd parameter.
+	}
+	return rawParsed[Post](ctx, b, "", query) // Execute the raw request.
+}
+
+// GetUserFeed fetches a raw page of a user's feed.
+func (b *HTTPBackend) GetUserFeed(ctx context.Context, uniqueID string, count int, cursor string) (*UserFeed, error) {
+	query := map[string]string{"unique_id": uniqueID, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[UserFeed](ctx, b, "user/posts", query)                                           // Execute the raw request.
+}
+
+// GetUserDetail fetches details for a user profile.
+func (b *HTTPBackend) GetUserDetail(ctx context.Context, uniqueID string) (*UserDetail, error) {
+	query := map[string]string{"unique_id": uniqueID}        // Construct the query parameters.
+	return rawParsed[UserDetail](ctx, b, "user/info", query) // Execute the raw request.
+}
+
+// GetChallengeInfo fetches details for a hashtag (challenge) by name.
+func (b *HTTPBackend) GetChallengeInfo(ctx context.Context, name string) (*ChallengeInfo, error) {
+	query := map[string]string{"challenge_name": name}               // Construct the query parameters.
+	return rawParsed[ChallengeInfo](ctx, b, "challenge/info", query) // Execute the raw request.
+}
+
+// GetChallengeFeed fetches a raw page of a hashtag's feed.
+func (b *HTTPBackend) GetChallengeFeed(ctx context.Context, challengeID string, count int, cursor string) (*UserFeed, error) {
+	query := map[string]string{"challenge_id": challengeID, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[UserFeed](ctx, b, "challenge/posts", query)                                            // Execute the raw request.
+}
+
+// GetMixFeed fetches a raw page of a playlist (mix).
+func (b *HTTPBackend) GetMixFeed(ctx context.Context, mixID string, count int, cursor string) (*UserFeed, error) {
+	query := map[string]string{"mix_id": mixID, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[UserFeed](ctx, b, "mix/posts", query)                                      // Execute the raw request.
+}
+
+// GetCollectionFeed fetches a raw page of a collection.
+func (b *HTTPBackend) GetCollectionFeed(ctx context.Context, collectionID string, count int, cursor string) (*UserFeed, error) {
+	query := map[string]string{"collection_id": collectionID, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[UserFeed](ctx, b, "collection/posts", query)                                             // Execute the raw request.
+}
+
+// SearchPosts fetches a raw page of the search feed for keywords.
+func (b *HTTPBackend) SearchPosts(ctx context.Context, keywords string, count int, cursor string) (*UserFeed, error) {
+	query := map[string]string{"keywords": keywords, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[UserFeed](ctx, b, "feed/search", query)                                         // Execute the raw request.
+}
+
+// GetComments fetches a raw page of a post's comments.
+func (b *HTTPBackend) GetComments(ctx context.Context, postID string, count int, cursor string) (*CommentPage, error) {
+	query := map[string]string{"url": postID, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[CommentPage](ctx, b, "comment/list", query)                              // Execute the raw request.
+}
+
+// GetCommentReplies fetches a raw page of replies to a comment.
+func (b *HTTPBackend) GetCommentReplies(ctx context.Context, commentID string, count int, cursor string) (*CommentPage, error) {
+	query := map[string]string{"comment_id": commentID, "count": strconv.Itoa(count), "cursor": cursor} // Construct the query parameters.
+	return rawParsed[CommentPage](ctx, b, "comment/reply", query)                                       // Execute the raw request.
+}
+
+// SubmitSourceEncode submits a video for source encoding and returns a task ID.
+func (b *HTTPBackend) SubmitSourceEncode(ctx context.Context, videoID string) (string, error) {
+	taskID, err := b.submitSourceEncode(ctx, videoID)
+	observeResponse(err)
+	return taskID, err
+}
+
+// submitSourceEncode sends the source encode submission request.
+func (b *HTTPBackend) submitSourceEncode(ctx context.Context, videoID string) (_ string, err error) {
+	if err := wait(ctx, "video/task/submit"); err != nil {
+		return "", fmt.Errorf("rate limiter stopped: %w", err)
+	}
+
+	var resp struct {
+		TaskID string `json:"task_id"` // TaskID is the ID of the source encoding task.
+	}
+	// This is a POST request, so we can't use rawParsed.
+	urlPath := fmt.Sprintf("%s/video/task/submit", b.baseURL()) // Construct the full URL.
+	formData := make(url.Values)                                // Initialize the map
+	formData.Set("web", "1")                                    // Set the web parameter.
+	formData.Set("url", videoID)                                // Set the URL parameter.
+
+	req, err := http.NewRequestWithContext(withEndpoint(ctx, "video/task/submit"), http.MethodPost, urlPath, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return "", err // Return an error if the request could not be created.
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpResp, key, err := b.send(req)
+	defer func() { checkKeyQuota(key, err) }()
+	if err != nil {
+		return "", err // Return an error if the request failed.
+	}
+	defer func() { _ = httpResp.Body.Close() }() // Close the response body.
+	body, err := io.ReadAll(httpResp.Body)       // Read the response body.
+	if err != nil {
+		return "", err // Return an error if the response body could not be read.
+	}
+
+	var baseResp struct {
+		Code int             `json:"code"` // Code is the response code.
+		Msg  string          `json:"msg"`  // Msg is the response message.
+		Data json.RawMessage `json:"data"` // Data is the response data.
+	}
+	if err := json.Unmarshal(body, &baseResp); err != nil { // Unmarshal the response body.
+		if httpResp.StatusCode >= http.StatusBadRequest {
+			return "", &APIError{Endpoint: "video/task/submit", HTTPStatus: httpResp.StatusCode}
+		}
+		return "", err // Return an error if the response body could not be unmarshaled.
+	}
+	if baseResp.Code != 0 || httpResp.StatusCode >= http.StatusBadRequest { // Check if the request failed.
+		return "", &APIError{Code: baseResp.Code, Msg: baseResp.Msg, Endpoint: "video/task/submit", HTTPStatus: httpResp.StatusCode}
+	}
+	if err := json.Unmarshal(baseResp.Data, &resp); err != nil { // Unmarshal the response data.
+		return "", err // Return an error if the response data could not be unmarshaled.
+	}
+	if resp.TaskID == "" { // Check if the task ID is empty.
+		return "", errors.New("API returned an empty task ID") // Return an error if the task ID is empty.
+	}
+	return resp.TaskID, nil // Return the task ID.
+}
+
+// PollSourceEncode checks the result of a source encode task once.
+func (b *HTTPBackend) PollSourceEncode(ctx context.Context, taskID string) (*SourceEncodeResult, bool, error) {
+	var resp struct {
+		Status int                 `json:"status"` // Status is the status of the source encoding task (2=success, 3=failure).
+		Detail *SourceEncodeResult `json:"detail"` // Detail is the details of the source encoding result.
+	}
+	data, err := rawParsed[json.RawMessage](ctx, b, "video/task/result", map[string]string{"task_id": taskID})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(*data, &resp); err != nil { // Unmarshal the response data.
+		return nil, false, fmt.Errorf("failed to parse source encode status: %w", err)
+	}
+	switch resp.Status {
+	case 2: // Success
+		return resp.Detail, true, nil
+	case 3: // Failure
+		return nil, true, ErrSourceEncodeFailed
+	}
+	return nil, false, nil // Still pending.
+}
@@ -0,0 +1,107 @@
+package tikwm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrRateLimited is matched by errors caused by tikwm's short-term request limit.
+	ErrRateLimited = errors.New("rate limited by tikwm")
+	// ErrDailyQuota is matched by errors caused by the daily request quota being exhausted.
+	ErrDailyQuota = errors.New("tikwm daily request quota exhausted")
+	// ErrPostNotFound is matched by errors for posts that do not exist or could not be resolved.
+	ErrPostNotFound = errors.New("post not found")
+	// ErrPrivateAccount is matched by errors for accounts whose content is private.
+	ErrPrivateAccount = errors.New("account is private")
+	// ErrUserNotFound is matched by errors for usernames that do not exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrHashtagNotFound is matched by errors for hashtags (challenges) that do not exist.
+	ErrHashtagNotFound = errors.New("hashtag not found")
+	// ErrPlaylistNotFound is matched by errors for playlists (mixes) and collections that do not exist.
+	ErrPlaylistNotFound = errors.New("playlist not found")
+	// ErrSourceEncodeFailed is returned when a source encode task fails or no higher quality is available.
+	ErrSourceEncodeFailed = errors.New("source encode task failed or no higher quality available")
+)
+
+// APIError is returned when the tikwm API answers with a non-zero code or an unexpected HTTP status.
+// Use errors.Is with the Err* sentinels to classify it, or errors.As to inspect the raw fields.
+type APIError struct {
+	Code       int    // Code is the "code" field of the response body (0 if the body was not parsed).
+	Msg        string // Msg is the "msg" field of the response body.
+	Endpoint   string // Endpoint is the API method that was called, e.g. "user/posts".
+	HTTPStatus int    // HTTPStatus is the status code of the HTTP response.
+	Query      string // Query is the JSON-encoded query of the request, if available.
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if e.Code == 0 && e.Msg == "" {
+		return fmt.Sprintf("tikwm error: HTTP %d [%s]", e.HTTPStatus, e.Endpoint)
+	}
+	if e.Query != "" {
+		return fmt.Sprintf("tikwm error: %s (%d) [%s, query: %s]", e.Msg, e.Code, e.Endpoint, e.Query)
+	}
+	return fmt.Sprintf("tikwm error: %s (%d) [%s]", e.Msg, e.Code, e.Endpoint)
+}
+
+// Is reports whether the error belongs to the category described by target.
+func (e *APIError) Is(target error) bool {
+	kind := e.kind()
+	return kind != nil && kind == target
+}
+
+// kind classifies the error into one of the sentinel errors, or nil if it matches none.
+// The API reports most failures with code -1, so the message is inspected first and
+// a bare -1 is treated as the short-term rate limit, matching the API's historic behaviour.
+func (e *APIError) kind() error {
+	msg := strings.ToLower(e.Msg)
+	switch {
+	case strings.Contains(msg, "free api limit") && strings.Contains(msg, "day"):
+		return ErrDailyQuota
+	case e.HTTPStatus == http.StatusTooManyRequests, e.Code == http.StatusTooManyRequests, strings.Contains(msg, "free api limit"):
+		return ErrRateLimited
+	case strings.Contains(msg, "private"):
+		return ErrPrivateAccount
+	case isUserEndpoint(e.Endpoint) && isNotFoundMsg(msg):
+		return ErrUserNotFound
+	case isChallengeEndpoint(e.Endpoint) && isNotFoundMsg(msg):
+		return ErrHashtagNotFound
+	case isPlaylistEndpoint(e.Endpoint) && isNotFoundMsg(msg):
+		return ErrPlaylistNotFound
+	case strings.Contains(msg, "url parsing is failed"), isNotFoundMsg(msg):
+		return ErrPostNotFound
+	case e.Code == -1:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// isNotFoundMsg reports whether a lower-cased API message says the requested resource does not exist,
+// e.g. "user doesn't exist" or "video not found".
+func isNotFoundMsg(msg string) bool {
+	return strings.Contains(msg, "not exist") || strings.Contains(msg, "n't exist") || strings.Contains(msg, "not found")
+}
+
+// isUserEndpoint reports whether the endpoint looks up a user rather than a post.
+func isUserEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "user/")
+}
+
+// isChallengeEndpoint reports whether the endpoint looks up a hashtag (challenge).
+func isChallengeEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "challenge/")
+}
+
+// isPlaylistEndpoint reports whether the endpoint looks up a playlist (mix) or collection.
+func isPlaylistEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "mix/") || strings.HasPrefix(endpoint, "collection/")
+}
+
+// IsDailyRateLimitError checks if an error indicates the daily API limit has been reached.
+// It is equivalent to errors.Is(err, ErrDailyQuota).
+func IsDailyRateLimitError(err error) bool {
+	return errors.Is(err, ErrDailyQuota)
+}
@@ -36,8 +36,12 @@ type FeedOpt struct {
 	// Filter is a Predicate used to filter posts.  Only posts that pass the filter are returned.
 	Filter Predicate
 	// While is a Predicate used to determine when to stop fetching posts.
-	// Fetching stops when this predicate returns false.
+	// Fetching stops when this predicate returns false, except for the posts tolerated by HeadTolerance.
 	While Predicate
+	// HeadTolerance is the number of posts at the head of a feed that are skipped, rather than ending the feed,
+	// when While returns false for them. Pinned posts are always skipped. This keeps old pinned posts, which
+	// are listed before newer ones, from ending a feed before any new post is seen.
+	HeadTolerance int
 	// OnError is a function that is called when an error occurs.
 	OnError func(err error)
 	// OnFeedProgress is a function that is called after each page of posts is fetched.
@@ -49,6 +53,23 @@ type FeedOpt struct {
 	SD bool
 }
 
+// Walker returns a function to be called with each post of a feed, in feed order, that applies While with
+// HeadTolerance taken into account. It reports whether the post passes While, and whether the feed ends at it.
+// The returned function keeps track of the position in the feed, so it must only be used for a single pass.
+func (opt *FeedOpt) Walker() func(post *Post) (pass bool, end bool) {
+	position := 0
+	return func(post *Post) (bool, bool) {
+		position++
+		if opt.While(post) {
+			return true, false
+		}
+		if post.IsPinned() || position <= opt.HeadTolerance {
+			return false, false // Out of order, skip it and keep going.
+		}
+		return false, true
+	}
+}
+
 // Defaults sets default values for the FeedOpt if they are not already set.
 func (opt *FeedOpt) Defaults() *FeedOpt {
 	if opt == nil {
@@ -0,0 +1,97 @@
+package tikwm
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFeedWalker(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	// Posts are "new" or "old" relative to since, and "pinned" ones are flagged as pinned by the API.
+	post := func(id string) *Post {
+		p := &Post{Id: id, CreateTime: since.Add(time.Hour).Unix()}
+		switch id[:3] {
+		case "old":
+			p.CreateTime = since.Add(-time.Hour).Unix()
+		case "pin":
+			p.CreateTime, p.IsTop = since.Add(-time.Hour).Unix(), 1
+		}
+		return p
+	}
+
+	tests := []struct {
+		name      string
+		tolerance int
+		feed      []string
+		wantPass  []string
+		wantEnd   string // ID of the post the feed ends at, or "" if it does not end.
+	}{
+		{
+			name:     "ends at the first old post",
+			feed:     []string{"new1", "new2", "old1", "new3"},
+			wantPass: []string{"new1", "new2"},
+			wantEnd:  "old1",
+		},
+		{
+			name:     "skips old pinned posts",
+			feed:     []string{"pin1", "pin2", "new1", "old1"},
+			wantPass: []string{"new1"},
+			wantEnd:  "old1",
+		},
+		{
+			name:     "skips pinned posts past the head",
+			feed:     []string{"new1", "new2", "new3", "new4", "pin1", "new5", "old1"},
+			wantPass: []string{"new1", "new2", "new3", "new4", "new5"},
+			wantEnd:  "old1",
+		},
+		{
+			name:      "tolerates old unflagged posts at the head",
+			tolerance: 2,
+			feed:      []string{"old1", "old2", "new1", "new2", "old3"},
+			wantPass:  []string{"new1", "new2"},
+			wantEnd:   "old3",
+		},
+		{
+			name:      "ends at an old post past the tolerance",
+			tolerance: 2,
+			feed:      []string{"old1", "old2", "old3", "new1"},
+			wantEnd:   "old3",
+		},
+		{
+			name:      "pinned posts count toward the tolerance",
+			tolerance: 2,
+			feed:      []string{"pin1", "old1", "old2", "new1"},
+			wantEnd:   "old2",
+		},
+		{
+			name:     "does not end while posts are new",
+			feed:     []string{"pin1", "new1", "new2"},
+			wantPass: []string{"new1", "new2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := (&FeedOpt{While: WhileAfter(since), HeadTolerance: tt.tolerance}).Defaults()
+			walk := opt.Walker()
+			var passed []string
+			end := ""
+			for _, id := range tt.feed {
+				pass, ended := walk(post(id))
+				if pass {
+					passed = append(passed, id)
+				}
+				if ended {
+					end = id
+					break
+				}
+			}
+			if !slices.Equal(passed, tt.wantPass) {
+				t.Errorf("passed %v, want %v", passed, tt.wantPass)
+			}
+			if end != tt.wantEnd {
+				t.Errorf("ended at %q, want %q", end, tt.wantEnd)
+			}
+		})
+	}
+}
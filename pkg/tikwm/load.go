@@ -181,6 +181,11 @@ func (post Post) IsAlbum() bool {
 	return len(post.Images) != 0
 }
 
+// IsPinned returns true if the post is pinned to the top of its author's profile.
+func (post Post) IsPinned() bool {
+	return post.IsTop != 0
+}
+
 // IsVideo returns true if the post is a video (not an album).
 func (post Post) IsVideo() bool {
 	return !post.IsAlbum()
@@ -0,0 +1,224 @@
+package tikwm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotRecorded is returned by ReplayTransport for API requests that have no recorded response.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Exchange is an API request and its response, as recorded by RecordingTransport.
+type Exchange struct {
+	Endpoint string `json:"endpoint"` // Endpoint is the API method, e.g. "user/posts". Post lookups use "".
+	Method   string `json:"method"`   // Method is the HTTP method of the request.
+	Query    string `json:"query"`    // Query is the encoded query string, or the form body of a POST request.
+	Status   int    `json:"status"`   // Status is the HTTP status code of the response.
+	Body     string `json:"body"`     // Body is the response body.
+}
+
+// request identifies the request of the exchange, so that a replay can find its response.
+func (e Exchange) request() string {
+	return fmt.Sprintf("%s %s?%s", e.Method, e.Endpoint, e.Query)
+}
+
+// endpointKey is the context key marking a request as an API request, holding its endpoint.
+type endpointKey struct{}
+
+// withEndpoint marks requests made with ctx as requests to the API endpoint.
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// requestEndpoint returns the API endpoint req is sent to, or false if req is not an API request,
+// e.g. a media download.
+func requestEndpoint(req *http.Request) (string, bool) {
+	endpoint, ok := req.Context().Value(endpointKey{}).(string)
+	return endpoint, ok
+}
+
+// newExchange returns the request half of the exchange for req, with its query passed through redact if not nil.
+// The body of req is read from a copy, so req can still be sent.
+func newExchange(req *http.Request, endpoint string, redact func(string) string) (Exchange, error) {
+	query := req.URL.RawQuery
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return Exchange{}, err
+		}
+		data, err := io.ReadAll(body)
+		_ = body.Close()
+		if err != nil {
+			return Exchange{}, err
+		}
+		query = string(data)
+	}
+	if redact != nil {
+		query = redact(query)
+	}
+	return Exchange{Endpoint: endpoint, Method: req.Method, Query: query}, nil
+}
+
+// RecordingTransport is an http.RoundTripper that saves every API request sent through it, with its response,
+// to a directory, so that a ReplayTransport can serve the same traffic again. Other requests pass through.
+type RecordingTransport struct {
+	next   http.RoundTripper
+	dir    string
+	redact func(string) string
+
+	mu  sync.Mutex
+	seq int // Number of exchanges in dir.
+}
+
+// NewRecordingTransport creates a RecordingTransport that sends requests with next and saves them to dir,
+// after any recordings already there. If redact is not nil, queries and response bodies are passed through it
+// before they are saved.
+func NewRecordingTransport(dir string, next http.RoundTripper, redact func(string) string) (*RecordingTransport, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingTransport{next: next, dir: dir, redact: redact, seq: len(existing)}, nil
+}
+
+// RoundTrip sends req and records it with its response if it is an API request.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint, ok := requestEndpoint(req)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	exchange, err := newExchange(req, endpoint, t.redact)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	exchange.Status, exchange.Body = resp.StatusCode, string(body)
+	if t.redact != nil {
+		exchange.Body = t.redact(exchange.Body)
+	}
+	if err := t.save(exchange); err != nil {
+		// A missing recording should not fail the run it is meant to help debug.
+		log.Printf("Failed to record %s request: %v", endpoint, err)
+	}
+	return resp, nil
+}
+
+// save writes exchange to the next file of the recording.
+func (t *RecordingTransport) save(exchange Exchange) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false) // Keep queries and URLs readable.
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(exchange); err != nil {
+		return err
+	}
+	name := "post"
+	if exchange.Endpoint != "" {
+		name = strings.ReplaceAll(exchange.Endpoint, "/", "_")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	return os.WriteFile(filepath.Join(t.dir, fmt.Sprintf("%06d_%s.json", t.seq, name)), data.Bytes(), 0600)
+}
+
+// ReplayTransport is an http.RoundTripper that answers API requests with the responses recorded by a
+// RecordingTransport, without network access. A request that was recorded several times, such as a retried
+// or polled one, gets its responses in recording order, and the last one once they have all been served.
+// Media is not recorded, so other requests get an empty response.
+type ReplayTransport struct {
+	redact func(string) string
+
+	mu        sync.Mutex
+	exchanges map[string][]Exchange // Recorded exchanges by request, in recording order.
+	served    map[string]int        // Number of responses served by request.
+}
+
+// NewReplayTransport creates a ReplayTransport serving the recording in dir. redact must be the function the
+// recording was made with, so that requests match their recorded, redacted, queries.
+func NewReplayTransport(dir string, redact func(string) string) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json")) // Sorted, so in recording order.
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded API traffic in %s", dir)
+	}
+	t := &ReplayTransport{redact: redact, exchanges: make(map[string][]Exchange), served: make(map[string]int)}
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		var exchange Exchange
+		if err := json.Unmarshal(data, &exchange); err != nil {
+			return nil, fmt.Errorf("invalid recording %s: %w", file, err)
+		}
+		t.exchanges[exchange.request()] = append(t.exchanges[exchange.request()], exchange)
+	}
+	return t, nil
+}
+
+// RoundTrip answers req from the recording.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer func() { _ = req.Body.Close() }()
+	}
+	endpoint, ok := requestEndpoint(req)
+	if !ok {
+		return replayResponse(req, http.StatusOK, ""), nil
+	}
+	exchange, err := newExchange(req, endpoint, t.redact)
+	if err != nil {
+		return nil, err
+	}
+	request := exchange.request()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	recorded := t.exchanges[request]
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("%w for %s", ErrNotRecorded, request)
+	}
+	exchange = recorded[min(t.served[request], len(recorded)-1)]
+	t.served[request]++
+	return replayResponse(req, exchange.Status, exchange.Body), nil
+}
+
+// replayResponse builds the response to req with the given status and body.
+func replayResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,592 @@
+// Package tikwmtest provides an in-process fake of the tikwm.com API for offline tests.
+//
+// A typical test registers some posts, points a client at the fake and runs a download:
+//
+//	srv := tikwmtest.NewServer()
+//	defer srv.Close()
+//	srv.AddPosts("some_user", tikwm.Post{Id: "1", CreateTime: 1700000000})
+//	srv.Fail(tikwmtest.EndpointUserFeed, tikwmtest.RateLimited, 1)
+//
+//	tikwm.RequestDelay = time.Millisecond
+//	tikwm.InitRateLimiter(ctx)
+//	defer tikwm.StopRateLimiter()
+//	c, _ := client.NewWithBackend(cfg, db, logger, srv.Backend())
+//	err := c.DownloadProfile(ctx, "some_user", false, logger, nil)
+package tikwmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+)
+
+// Endpoint names accepted by Server.Fail and Server.Requests.
+const (
+	EndpointPost           = "post"
+	EndpointUserFeed       = "user/posts"
+	EndpointUserInfo       = "user/info"
+	EndpointChallengeInfo  = "challenge/info"
+	EndpointChallengeFeed  = "challenge/posts"
+	EndpointMixFeed        = "mix/posts"
+	EndpointCollectionFeed = "collection/posts"
+	EndpointSearch         = "feed/search"
+	EndpointComments       = "comment/list"
+	EndpointReplies        = "comment/reply"
+	EndpointSourceSubmit   = "video/task/submit"
+	EndpointSourceResult   = "video/task/result"
+)
+
+// Failure is a scripted error response.
+type Failure int
+
+const (
+	// RateLimited responds like tikwm's per-second request limit (code -1).
+	RateLimited Failure = iota + 1
+	// TooManyRequests responds with HTTP 429.
+	TooManyRequests
+	// DailyQuota responds with tikwm's daily request limit message.
+	DailyQuota
+	// NotFound responds as if the requested post, user, hashtag or playlist does not exist.
+	NotFound
+	// Private responds as if the requested account is private.
+	Private
+)
+
+// sourceTask tracks a fake source encode task.
+type sourceTask struct {
+	videoID string
+	polls   int
+}
+
+// Server is a fake tikwm API backed by httptest.Server.
+// It serves posts, paginated user, hashtag, playlist and search feeds, comments, user details, source encode tasks and the media files they point to.
+type Server struct {
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	posts       map[string]tikwm.Post
+	feeds       map[string][]string
+	hashtags    map[string][]string
+	playlists   map[string][]string
+	comments    map[string][]tikwm.Comment
+	replies     map[string][]tikwm.Comment
+	details     map[string]tikwm.UserDetail
+	failures    map[string][]Failure
+	requests    map[string]int
+	keys        map[string]int
+	tasks       map[string]*sourceTask
+	sourcePolls int
+}
+
+// NewServer starts a new fake API server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		posts:     make(map[string]tikwm.Post),
+		feeds:     make(map[string][]string),
+		hashtags:  make(map[string][]string),
+		comments:  make(map[string][]tikwm.Comment),
+		playlists: make(map[string][]string),
+		replies:   make(map[string][]tikwm.Comment),
+		details:   make(map[string]tikwm.UserDetail),
+		failures:  make(map[string][]Failure),
+		requests:  make(map[string]int),
+		keys:      make(map[string]int),
+		tasks:     make(map[string]*sourceTask),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", s.handleAPI)
+	mux.HandleFunc("/media/", s.handleMedia)
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base API URL, suitable for tikwm.URL or tikwm.NewHTTPBackend.
+func (s *Server) URL() string {
+	return s.srv.URL + "/api"
+}
+
+// Backend returns an HTTP backend that talks to this server.
+func (s *Server) Backend() *tikwm.HTTPBackend {
+	b := tikwm.NewHTTPBackend(s.URL())
+	b.Client = s.srv.Client()
+	return b
+}
+
+// AddPosts adds posts to a user's feed and makes them available for single-post lookup.
+// Missing author names, media URLs and sizes are filled in so the posts can be downloaded from the server.
+func (s *Server) AddPosts(uniqueID string, posts ...tikwm.Post) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, post := range posts {
+		s.addPost(uniqueID, post)
+	}
+}
+
+// AddHashtagPosts adds posts to a hashtag's feed, as well as to their authors' feeds.
+// Hashtag feeds are served in the order the posts were added rather than by creation time,
+// like the popularity-ordered feeds of the real API.
+func (s *Server) AddHashtagPosts(tag string, posts ...tikwm.Post) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tag = normalizeTag(tag)
+	for _, post := range posts {
+		id := s.addPost(post.Author.UniqueId, post)
+		if !slices.Contains(s.hashtags[tag], id) {
+			s.hashtags[tag] = append(s.hashtags[tag], id)
+		}
+	}
+}
+
+// addPost fills in and stores a post and adds it to the user's feed, returning its ID.
+func (s *Server) addPost(uniqueID string, post tikwm.Post) string {
+	id := post.ID()
+	if post.Author.UniqueId == "" {
+		post.Author.UniqueId = uniqueID
+	}
+	for i, img := range post.Images {
+		if img == "" {
+			post.Images[i] = s.mediaURL(id, fmt.Sprintf("image_%d", i+1))
+		}
+	}
+	if post.IsVideo() {
+		if post.Play == "" {
+			post.Play, post.Size = s.mediaURL(id, "sd"), len(mediaBody(id, "sd"))
+		}
+		if post.Hdplay == "" {
+			post.Hdplay, post.HdSize = s.mediaURL(id, "hd"), len(mediaBody(id, "hd"))
+		}
+		if post.Wmplay == "" {
+			post.Wmplay, post.WmSize = s.mediaURL(id, "wm"), len(mediaBody(id, "wm"))
+		}
+	}
+	if music := &post.MusicInfo; music.Id != "" {
+		if music.Play == "" {
+			music.Play = s.mediaURL(music.Id, "music")
+		}
+		if music.Cover == "" {
+			music.Cover = s.mediaURL(music.Id, "music_cover")
+		}
+	}
+	if _, exists := s.posts[id]; !exists {
+		s.feeds[uniqueID] = append(s.feeds[uniqueID], id)
+	}
+	s.posts[id] = post
+	return id
+}
+
+// AddMixPosts appends posts to a playlist (mix), as well as to their authors' feeds.
+// Playlists are served in the order the posts were added.
+func (s *Server) AddMixPosts(mixID string, posts ...tikwm.Post) {
+	s.addPlaylistPosts(EndpointMixFeed, mixID, posts)
+}
+
+// AddCollectionPosts appends posts to a collection, as well as to their authors' feeds.
+// Collections are served in the order the posts were added.
+func (s *Server) AddCollectionPosts(collectionID string, posts ...tikwm.Post) {
+	s.addPlaylistPosts(EndpointCollectionFeed, collectionID, posts)
+}
+
+// addPlaylistPosts appends posts to the playlist or collection served by endpoint.
+func (s *Server) addPlaylistPosts(endpoint, id string, posts []tikwm.Post) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := endpoint + "/" + id
+	for _, post := range posts {
+		postID := s.addPost(post.Author.UniqueId, post)
+		if !slices.Contains(s.playlists[key], postID) {
+			s.playlists[key] = append(s.playlists[key], postID)
+		}
+	}
+}
+
+// SetComments sets the comments of a post, replacing any previous ones.
+// The Replies of each comment are served by the reply endpoint rather than the comment list,
+// and missing video IDs and reply totals are filled in.
+func (s *Server) SetComments(postID string, comments ...tikwm.Comment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]tikwm.Comment, 0, len(comments))
+	for _, comment := range comments {
+		if comment.VideoId == "" {
+			comment.VideoId = postID
+		}
+		replies := comment.Replies
+		for i := range replies {
+			if replies[i].VideoId == "" {
+				replies[i].VideoId = postID
+			}
+		}
+		s.replies[comment.Id] = replies
+		comment.Replies = nil
+		comment.ReplyTotal = len(replies)
+		list = append(list, comment)
+	}
+	s.comments[postID] = list
+}
+
+// SetUserDetail sets the response of the user/info endpoint for a user.
+func (s *Server) SetUserDetail(uniqueID string, detail tikwm.UserDetail) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.details[uniqueID] = detail
+}
+
+// Fail makes the next `times` requests to endpoint fail with the given failure.
+func (s *Server) Fail(endpoint string, failure Failure, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.failures[endpoint] = append(s.failures[endpoint], failure)
+	}
+}
+
+// SetSourceEncodePolls sets how many result polls a source encode task stays pending before it completes.
+func (s *Server) SetSourceEncodePolls(polls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sourcePolls = polls
+}
+
+// Requests returns how many requests have been made to endpoint, including failed ones.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// KeyRequests returns how many requests have been made with the given API key, including failed ones.
+// Requests without a key are counted under the empty key.
+func (s *Server) KeyRequests(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[key]
+}
+
+// handleAPI dispatches an API request to the matching endpoint handler.
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+	if endpoint == "" {
+		endpoint = EndpointPost
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[endpoint]++
+	s.keys[r.Header.Get(tikwm.APIKeyHeader)]++
+	if queue := s.failures[endpoint]; len(queue) > 0 {
+		s.failures[endpoint] = queue[1:]
+		writeFailure(w, endpoint, queue[0])
+		return
+	}
+
+	switch endpoint {
+	case EndpointPost:
+		s.servePost(w, r.Form.Get("url"))
+	case EndpointUserFeed:
+		s.serveUserFeed(w, r.Form.Get("unique_id"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointUserInfo:
+		s.serveUserInfo(w, r.Form.Get("unique_id"))
+	case EndpointMixFeed:
+		s.servePlaylistFeed(w, EndpointMixFeed, r.Form.Get("mix_id"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointCollectionFeed:
+		s.servePlaylistFeed(w, EndpointCollectionFeed, r.Form.Get("collection_id"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointSearch:
+		s.serveSearch(w, r.Form.Get("keywords"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointComments:
+		s.serveComments(w, r.Form.Get("url"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointReplies:
+		s.serveCommentReplies(w, r.Form.Get("comment_id"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointChallengeInfo:
+		s.serveChallengeInfo(w, r.Form.Get("challenge_name"))
+	case EndpointChallengeFeed:
+		s.serveChallengeFeed(w, r.Form.Get("challenge_id"), r.Form.Get("count"), r.Form.Get("cursor"))
+	case EndpointSourceSubmit:
+		s.serveSourceSubmit(w, r.Form.Get("url"))
+	case EndpointSourceResult:
+		s.serveSourceResult(w, r.Form.Get("task_id"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// servePost answers a single-post lookup by ID or video URL.
+func (s *Server) servePost(w http.ResponseWriter, target string) {
+	post, ok := s.posts[postIDFromURL(target)]
+	if !ok {
+		writeFailure(w, EndpointPost, NotFound)
+		return
+	}
+	writeData(w, post)
+}
+
+// serveUserFeed answers one page of a user's feed: pinned posts (IsTop) first like on TikTok, then newest posts first.
+func (s *Server) serveUserFeed(w http.ResponseWriter, uniqueID, countStr, cursorStr string) {
+	ids, ok := s.feeds[uniqueID]
+	if !ok {
+		writeFailure(w, EndpointUserFeed, NotFound)
+		return
+	}
+	posts := make([]tikwm.Post, 0, len(ids))
+	for _, id := range ids {
+		posts = append(posts, s.posts[id])
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		if posts[i].IsPinned() != posts[j].IsPinned() {
+			return posts[i].IsPinned()
+		}
+		return posts[i].CreateTime > posts[j].CreateTime
+	})
+	writeFeedPage(w, posts, countStr, cursorStr)
+}
+
+// servePlaylistFeed answers one page of a playlist or collection, in the order the posts were added.
+func (s *Server) servePlaylistFeed(w http.ResponseWriter, endpoint, id, countStr, cursorStr string) {
+	ids, ok := s.playlists[endpoint+"/"+id]
+	if !ok {
+		writeFailure(w, endpoint, NotFound)
+		return
+	}
+	posts := make([]tikwm.Post, 0, len(ids))
+	for _, postID := range ids {
+		posts = append(posts, s.posts[postID])
+	}
+	writeFeedPage(w, posts, countStr, cursorStr)
+}
+
+// serveSearch answers one page of the search feed, containing every post whose title contains keywords.
+// Results are ordered by post ID rather than by creation time.
+func (s *Server) serveSearch(w http.ResponseWriter, keywords, countStr, cursorStr string) {
+	keywords = strings.ToLower(strings.TrimSpace(keywords))
+	var posts []tikwm.Post
+	for _, post := range s.posts {
+		if keywords != "" && strings.Contains(strings.ToLower(post.Title), keywords) {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID() < posts[j].ID() })
+	writeFeedPage(w, posts, countStr, cursorStr)
+}
+
+// serveComments answers one page of a post's comments.
+func (s *Server) serveComments(w http.ResponseWriter, target, countStr, cursorStr string) {
+	postID := postIDFromURL(target)
+	if _, ok := s.posts[postID]; !ok {
+		writeFailure(w, EndpointComments, NotFound)
+		return
+	}
+	writeCommentPage(w, s.comments[postID], countStr, cursorStr)
+}
+
+// serveCommentReplies answers one page of replies to a comment.
+func (s *Server) serveCommentReplies(w http.ResponseWriter, commentID, countStr, cursorStr string) {
+	writeCommentPage(w, s.replies[commentID], countStr, cursorStr)
+}
+
+// writeCommentPage writes the page of comments selected by an integer offset cursor.
+func writeCommentPage(w http.ResponseWriter, comments []tikwm.Comment, countStr, cursorStr string) {
+	offset, end := pageBounds(len(comments), countStr, cursorStr, tikwm.MaxCommentCount)
+	writeData(w, tikwm.CommentPage{
+		Comments: comments[offset:end],
+		Cursor:   json.Number(strconv.Itoa(end)),
+		HasMore:  end < len(comments),
+		Total:    len(comments),
+	})
+}
+
+// pageBounds returns the slice bounds of the page selected by an integer offset cursor.
+func pageBounds(total int, countStr, cursorStr string, defaultCount int) (offset, end int) {
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		count = defaultCount
+	}
+	offset, _ = strconv.Atoi(cursorStr)
+	if offset < 0 || offset > total {
+		offset = total
+	}
+	return offset, min(offset+count, total)
+}
+
+// serveChallengeInfo answers a hashtag detail lookup.
+func (s *Server) serveChallengeInfo(w http.ResponseWriter, name string) {
+	tag := normalizeTag(name)
+	ids, ok := s.hashtags[tag]
+	if !ok {
+		writeFailure(w, EndpointChallengeInfo, NotFound)
+		return
+	}
+	writeData(w, tikwm.ChallengeInfo{Id: challengeIDPrefix + tag, ChaName: tag, UserCount: int64(len(ids))})
+}
+
+// serveChallengeFeed answers one page of a hashtag's feed, in the order the posts were added.
+func (s *Server) serveChallengeFeed(w http.ResponseWriter, challengeID, countStr, cursorStr string) {
+	ids, ok := s.hashtags[strings.TrimPrefix(challengeID, challengeIDPrefix)]
+	if !ok {
+		writeFailure(w, EndpointChallengeFeed, NotFound)
+		return
+	}
+	posts := make([]tikwm.Post, 0, len(ids))
+	for _, id := range ids {
+		posts = append(posts, s.posts[id])
+	}
+	writeFeedPage(w, posts, countStr, cursorStr)
+}
+
+// writeFeedPage writes the page of posts selected by an integer offset cursor.
+func writeFeedPage(w http.ResponseWriter, posts []tikwm.Post, countStr, cursorStr string) {
+	offset, end := pageBounds(len(posts), countStr, cursorStr, tikwm.MaxUserFeedCount)
+	writeData(w, tikwm.UserFeed{
+		Videos:  posts[offset:end],
+		Cursor:  strconv.Itoa(end),
+		HasMore: end < len(posts),
+	})
+}
+
+// serveUserInfo answers a user detail lookup.
+func (s *Server) serveUserInfo(w http.ResponseWriter, uniqueID string) {
+	detail, ok := s.details[uniqueID]
+	if !ok {
+		if _, hasFeed := s.feeds[uniqueID]; !hasFeed {
+			writeFailure(w, EndpointUserInfo, NotFound)
+			return
+		}
+		detail.User.UniqueId = uniqueID
+		detail.Stats.VideoCount = len(s.feeds[uniqueID])
+	}
+	writeData(w, detail)
+}
+
+// serveSourceSubmit creates a new source encode task.
+func (s *Server) serveSourceSubmit(w http.ResponseWriter, videoID string) {
+	if _, ok := s.posts[postIDFromURL(videoID)]; !ok {
+		writeFailure(w, EndpointSourceSubmit, NotFound)
+		return
+	}
+	taskID := fmt.Sprintf("task-%d", len(s.tasks)+1)
+	s.tasks[taskID] = &sourceTask{videoID: postIDFromURL(videoID)}
+	writeData(w, map[string]string{"task_id": taskID})
+}
+
+// serveSourceResult reports the status of a source encode task.
+func (s *Server) serveSourceResult(w http.ResponseWriter, taskID string) {
+	task, ok := s.tasks[taskID]
+	if !ok {
+		writeData(w, map[string]any{"status": 3})
+		return
+	}
+	task.polls++
+	if task.polls <= s.sourcePolls {
+		writeData(w, map[string]any{"status": 1})
+		return
+	}
+	writeData(w, map[string]any{
+		"status": 2,
+		"detail": tikwm.SourceEncodeResult{
+			PlayURL: s.mediaURL(task.videoID, "source"),
+			Size:    len(mediaBody(task.videoID, "source")),
+		},
+	})
+}
+
+// handleMedia serves deterministic fake media bytes for /media/<post id>/<variant>.
+func (s *Server) handleMedia(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/media/"), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	body := mediaBody(parts[0], parts[1])
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	_, _ = w.Write(body)
+}
+
+// mediaURL returns the URL at which the server serves a media variant of a post or music track.
+func (s *Server) mediaURL(postID, variant string) string {
+	return fmt.Sprintf("%s/media/%s/%s", s.srv.URL, postID, variant)
+}
+
+// mediaBody returns the fake content of a media variant of a post.
+func mediaBody(postID, variant string) []byte {
+	return []byte(fmt.Sprintf("tikwmtest media %s %s\n", postID, variant))
+}
+
+// challengeIDPrefix is prepended to hashtag names to form fake challenge IDs.
+const challengeIDPrefix = "challenge-"
+
+// normalizeTag returns the lower-case hashtag name without a leading '#'.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// postIDFromURL extracts a post ID from a TikTok video URL, or returns the input if it is already an ID.
+func postIDFromURL(target string) string {
+	target = strings.TrimSpace(target)
+	if i := strings.Index(target, "/video/"); i >= 0 {
+		target = target[i+len("/video/"):]
+	}
+	if i := strings.IndexAny(target, "/?"); i >= 0 {
+		target = target[:i]
+	}
+	return target
+}
+
+// writeData writes a successful API response envelope.
+func writeData(w http.ResponseWriter, data any) {
+	writeJSON(w, http.StatusOK, 0, "success", data)
+}
+
+// writeFailure writes the API response for a scripted failure.
+func writeFailure(w http.ResponseWriter, endpoint string, failure Failure) {
+	switch failure {
+	case RateLimited:
+		writeJSON(w, http.StatusOK, -1, "Free Api Limit: 1 request/second.", nil)
+	case TooManyRequests:
+		writeJSON(w, http.StatusTooManyRequests, http.StatusTooManyRequests, "Too Many Requests", nil)
+	case DailyQuota:
+		writeJSON(w, http.StatusOK, -1, "Free Api Limit: 10000 request/ 1 day.", nil)
+	case Private:
+		writeJSON(w, http.StatusOK, -1, "This account is private.", nil)
+	default:
+		if strings.HasPrefix(endpoint, "user/") {
+			writeJSON(w, http.StatusOK, -1, "User doesn't exist.", nil)
+			return
+		}
+		if strings.HasPrefix(endpoint, "mix/") || strings.HasPrefix(endpoint, "collection/") {
+			writeJSON(w, http.StatusOK, -1, "Playlist doesn't exist.", nil)
+			return
+		}
+		if strings.HasPrefix(endpoint, "challenge/") {
+			writeJSON(w, http.StatusOK, -1, "Challenge doesn't exist.", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, -1, "Url parsing is failed! Please check url.", nil)
+	}
+}
+
+// writeJSON writes a tikwm response envelope with the given status, code, message and data.
+func writeJSON(w http.ResponseWriter, status, code int, msg string, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"code":           code,
+		"msg":            msg,
+		"processed_time": 0.01,
+		"data":           data,
+	})
+}
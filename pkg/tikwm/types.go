@@ -1,5 +1,7 @@
 package tikwm
 
+import "encoding/json"
+
 // AssetType defines the type of media asset.
 type AssetType string
 
@@ -10,6 +12,8 @@ const (
 	AssetSD AssetType = "sd"
 	// AssetSource represents the original source asset.
 	AssetSource AssetType = "source"
+	// AssetWatermarked represents the watermarked video, as shared from the TikTok app.
+	AssetWatermarked AssetType = "wm"
 	// AssetCoverMedium represents a medium-sized cover asset.
 	AssetCoverMedium AssetType = "cover_medium"
 	// AssetCoverOrigin represents the original cover asset.
@@ -22,8 +26,32 @@ const (
 	AssetAvatar AssetType = "avatar"
 	// AssetCover represents a generic cover asset for DB operations.
 	AssetCover AssetType = "cover" // Generic type for DB operations
+	// AssetMusic represents the audio track of a post's sound, stored once per music ID.
+	AssetMusic AssetType = "music"
+	// AssetMusicCover represents the cover image of a post's sound, stored once per music ID.
+	AssetMusicCover AssetType = "music_cover"
 )
 
+// MusicInfo contains information about the music (sound) used in a post.
+type MusicInfo struct {
+	// Id is the unique identifier of the music.
+	Id string `json:"id"`
+	// Title is the title of the music.
+	Title string `json:"title"`
+	// Play is the URL of the music.
+	Play string `json:"play"`
+	// Cover is the URL of the music's cover image.
+	Cover string `json:"cover"`
+	// Author is the author of the music.
+	Author string `json:"author"`
+	// Original indicates whether the music is original.
+	Original bool `json:"original"`
+	// Duration is the duration of the music, can be a number or a string.
+	Duration interface{} `json:"duration"` // Changed to interface{} to handle number or string
+	// Album is the album the music belongs to.
+	Album string `json:"album"`
+}
+
 // Post represents a TikTok post.
 type Post struct {
 	// Id is the unique identifier of the post.
@@ -57,24 +85,7 @@ type Post struct {
 	// Music is the URL of the music used in the post.
 	Music string `json:"music"`
 	// MusicInfo contains information about the music used in the post.
-	MusicInfo struct {
-		// Id is the unique identifier of the music.
-		Id string `json:"id"`
-		// Title is the title of the music.
-		Title string `json:"title"`
-		// Play is the URL of the music.
-		Play string `json:"play"`
-		// Cover is the URL of the music's cover image.
-		Cover string `json:"cover"`
-		// Author is the author of the music.
-		Author string `json:"author"`
-		// Original indicates whether the music is original.
-		Original bool `json:"original"`
-		// Duration is the duration of the music, can be a number or a string.
-		Duration interface{} `json:"duration"` // Changed to interface{} to handle number or string
-		// Album is the album the music belongs to.
-		Album string `json:"album"`
-	} `json:"music_info"`
+	MusicInfo MusicInfo `json:"music_info"`
 	// PlayCount is the number of times the post has been played.
 	PlayCount int `json:"play_count"`
 	// DiggCount is the number of likes the post has received.
@@ -95,6 +106,8 @@ type Post struct {
 	AnchorsExtras string `json:"anchors_extras"`
 	// IsAd indicates whether the post is an advertisement.
 	IsAd bool `json:"is_ad"`
+	// IsTop is 1 if the post is pinned to the top of its author's profile.
+	IsTop int `json:"is_top"`
 	// CommerceInfo contains information about the post's commercial aspects.
 	CommerceInfo struct {
 		// AdvPromotable indicates whether the post can be promoted as an advertisement.
@@ -121,6 +134,18 @@ type Post struct {
 	} `json:"author"`
 	// Images is a list of image URLs in the post.
 	Images []string `json:"images"`
+	// Raw is the post as it was decoded, including the fields that Post does not have.
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes a post and keeps a copy of data in Raw.
+func (post *Post) UnmarshalJSON(data []byte) error {
+	type plainPost Post // Without the UnmarshalJSON method, so that decoding it does not recurse.
+	if err := json.Unmarshal(data, (*plainPost)(post)); err != nil {
+		return err
+	}
+	post.Raw = append(json.RawMessage(nil), data...)
+	return nil
 }
 
 // ID returns the ID of the post, using VideoId if Id is empty.
@@ -208,3 +233,61 @@ type UserDetail struct {
 		Heart int `json:"heart"`
 	} `json:"stats"`
 }
+
+// ChallengeInfo represents information about a hashtag (challenge).
+type ChallengeInfo struct {
+	// Id is the unique identifier of the challenge, used to page through its feed.
+	Id string `json:"id"`
+	// ChaName is the name of the hashtag, without the leading '#'.
+	ChaName string `json:"cha_name"`
+	// Desc is the description of the challenge.
+	Desc string `json:"desc"`
+	// UserCount is the number of users who have posted with the hashtag.
+	UserCount int64 `json:"user_count"`
+	// ViewCount is the total number of views of posts with the hashtag.
+	ViewCount int64 `json:"view_count"`
+	// Cover is the URL of the challenge's cover image.
+	Cover string `json:"cover"`
+}
+
+// Comment represents a comment on a post.
+type Comment struct {
+	// Id is the unique identifier of the comment.
+	Id string `json:"id"`
+	// VideoId is the identifier of the post the comment belongs to.
+	VideoId string `json:"video_id"`
+	// Text is the text of the comment.
+	Text string `json:"text"`
+	// CreateTime is the creation time of the comment in Unix epoch seconds.
+	CreateTime int64 `json:"create_time"`
+	// DiggCount is the number of likes the comment has received.
+	DiggCount int `json:"digg_count"`
+	// ReplyTotal is the number of replies to the comment.
+	ReplyTotal int `json:"reply_total"`
+	// User contains information about the author of the comment.
+	User struct {
+		// Id is the unique identifier of the user.
+		Id string `json:"id"`
+		// UniqueId is the unique ID of the user.
+		UniqueId string `json:"unique_id"`
+		// Nickname is the nickname of the user.
+		Nickname string `json:"nickname"`
+		// Avatar is the URL of the user's avatar image.
+		Avatar string `json:"avatar"`
+	} `json:"user"`
+	// Replies is the reply thread of the comment.
+	// It is not returned by the comment list endpoint and is filled in by callers that fetch replies.
+	Replies []Comment `json:"replies,omitempty"`
+}
+
+// CommentPage represents one page of comments or comment replies.
+type CommentPage struct {
+	// Comments is a list of comments in the page.
+	Comments []Comment `json:"comments"`
+	// Cursor is the cursor for pagination. The API returns it as a number.
+	Cursor json.Number `json:"cursor"`
+	// HasMore indicates whether there are more comments to load.
+	HasMore bool `json:"hasMore"`
+	// Total is the total number of comments.
+	Total int `json:"total"`
+}
@@ -3,8 +3,8 @@ package cmd
 import (
 	"fmt"
 
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
 	"github.com/perpetuallyhorni/tikwm/pkg/client"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
 	"github.com/spf13/cobra"
 )
 
@@ -34,7 +34,7 @@ This is useful for inspecting the data structure returned by the API.`,
 		// We use the raw method to get the bytes without any parsing or error handling on the content.
 		// We call the 'user/posts' method with a count of 5 to get a small, representative sample.
 		query := map[string]string{"unique_id": username, "count": "5", "cursor": "0"}
-		responseBytes, err := tikwm.Raw("user/posts", query)
+		responseBytes, err := tikwm.Raw(cmd.Context(), "user/posts", query)
 		if err != nil {
 			return fmt.Errorf("failed to get raw feed for %s: %w", username, err)
 		}
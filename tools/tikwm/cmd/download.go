@@ -44,10 +44,11 @@ type TargetManager struct {
 // downloadCmd represents the 'download' command.
 var downloadCmd = &cobra.Command{
 	Use:     "download [targets...]",
-	Short:   "Download posts or entire user profiles from TikTok (default command).",
+	Short:   "Download posts, user profiles, playlists, hashtags or searches from TikTok (default command).",
 	Aliases: []string{"dl"},
-	Long: `Downloads posts or entire user profiles from TikTok.
-Targets can be usernames or URLs passed as arguments or listed in a targets file.
+	Long: `Downloads posts, entire user profiles, playlists, hashtags or keyword searches from TikTok.
+Targets can be usernames, URLs, #hashtags or search:<query> passed as arguments or listed in a targets file
+(hashtags in a targets file must be given as URLs, since lines starting with '#' are comments).
 If using a targets file, the file will be monitored for changes, and workers
 will be dynamically reassigned based on the file's content (hot-reloading).
 This is the default command if you provide targets without a subcommand.`,
@@ -64,6 +65,9 @@ func runDownload(cmd *cobra.Command, args []string) error {
 	}
 
 	force, _ := cmd.Flags().GetBool("force")
+	if restart, _ := cmd.Flags().GetBool("restart"); restart {
+		clearFeedCheckpoints(targets)
+	}
 
 	if isFromFile && cfg.TargetsFile != "" && cfg.DaemonMode {
 		return runDynamicDownload(force)
@@ -99,6 +103,7 @@ func runStaticDownload(force bool, targets []string, isFromFile bool) error {
 
 	workerPool.Stop()
 	console.StopRenderer()
+	reportFallbacks()
 	return nil
 }
 
@@ -286,6 +291,7 @@ func (tm *TargetManager) enterDaemonPoll() {
 		tm.console.Warn("Invalid daemon_poll_interval '%s', using default 60s. Error: %v", tm.cfg.DaemonPollInterval, err)
 	}
 
+	reportFallbacks()
 	tm.console.Info("All targets processed. Entering low-frequency poll mode (checking every %s).", pollInterval)
 
 	go func() {
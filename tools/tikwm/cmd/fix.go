@@ -53,6 +53,7 @@ and downloads any videos that are missing the qualities specified in your config
 
 		workerPool.Stop()
 		console.StopRenderer()
+		reportFallbacks()
 		return nil
 	},
 }
@@ -7,26 +7,32 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
 	"github.com/perpetuallyhorni/tikwm/pkg/client"
 	"github.com/perpetuallyhorni/tikwm/pkg/logging"
+	"github.com/perpetuallyhorni/tikwm/pkg/network"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
 	"github.com/perpetuallyhorni/tikwm/tools/tikwm/internal/cli"
 	cliconfig "github.com/perpetuallyhorni/tikwm/tools/tikwm/internal/config"
 	"github.com/spf13/cobra"
 )
 
-// ParsedTarget represents a parsed target, which can be either a user or a post.
+// ParsedTarget represents a parsed target, which can be a user, a post, a hashtag, a playlist or a search.
 type ParsedTarget struct {
-	Type  string // "user" or "post"
+	Type  string // "user", "post", "hashtag", "playlist" or "search"
 	Value string // original string
 }
 
+// searchPrefix marks a target as a keyword search, e.g. "search:some keywords".
+const searchPrefix = "search:"
+
 // applyFlagOverrides applies command-line flag overrides to the configuration.
 func applyFlagOverrides(cmd *cobra.Command, cfg *cliconfig.Config) {
 	if cmd.Flag("dir").Changed {
@@ -58,15 +64,33 @@ func applyFlagOverrides(cmd *cobra.Command, cfg *cliconfig.Config) {
 	if cmd.Flag("download-avatars").Changed {
 		cfg.DownloadAvatars, _ = cmd.Flags().GetBool("download-avatars")
 	}
+	if cmd.Flag("download-music").Changed {
+		cfg.DownloadMusic, _ = cmd.Flags().GetBool("download-music")
+	}
 	if cmd.Flag("save-post-title").Changed {
 		cfg.SavePostTitle, _ = cmd.Flags().GetBool("save-post-title")
 	}
+	if cmd.Flag("save-comments").Changed {
+		cfg.SaveComments, _ = cmd.Flags().GetBool("save-comments")
+	}
+	if cmd.Flag("save-post-metadata").Changed {
+		cfg.SavePostMetadata, _ = cmd.Flags().GetBool("save-post-metadata")
+	}
+	if cmd.Flag("feed-order").Changed {
+		cfg.FeedOrder, _ = cmd.Flags().GetString("feed-order")
+	}
 	if cmd.Flag("feed-cache").Changed {
 		cfg.FeedCache, _ = cmd.Flags().GetBool("feed-cache")
 	}
 	if cmd.Flag("feed-cache-ttl").Changed {
 		cfg.FeedCacheTTL, _ = cmd.Flags().GetString("feed-cache-ttl")
 	}
+	if cmd.Flag("incremental-sync").Changed {
+		cfg.IncrementalSync, _ = cmd.Flags().GetBool("incremental-sync")
+	}
+	if full, _ := cmd.Flags().GetBool("full-rescan"); full {
+		cfg.FullRescanInterval = "0s" // Every feed is due for a full scan.
+	}
 	if cmd.Flag("bind").Changed {
 		cfg.BindAddress, _ = cmd.Flags().GetString("bind")
 	}
@@ -119,18 +143,190 @@ func getTargetsFromFile(filePath string, console *cli.Console) []string {
 	return fileTargets
 }
 
-// parseTarget parses a target string and determines its type (user or post).
+// parseTarget parses a target string and determines its type (user, post, hashtag, playlist or search).
 func parseTarget(target string) ParsedTarget {
 	trimmedTarget := strings.TrimSpace(target)
+	if strings.HasPrefix(trimmedTarget, searchPrefix) {
+		return ParsedTarget{Type: "search", Value: trimmedTarget}
+	}
+	if strings.HasPrefix(trimmedTarget, "#") {
+		return ParsedTarget{Type: "hashtag", Value: trimmedTarget}
+	}
+	if _, err := client.ParsePlaylistURL(trimmedTarget); err == nil && strings.Contains(trimmedTarget, "tiktok.com") {
+		return ParsedTarget{Type: "playlist", Value: trimmedTarget}
+	}
 	if strings.Contains(trimmedTarget, "tiktok.com") && strings.Contains(trimmedTarget, "/video/") {
 		return ParsedTarget{Type: "post", Value: trimmedTarget}
 	}
+	if strings.Contains(trimmedTarget, "tiktok.com") && strings.Contains(trimmedTarget, "/tag/") {
+		return ParsedTarget{Type: "hashtag", Value: trimmedTarget}
+	}
 	if u, err := url.Parse(trimmedTarget); err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.Contains(u.Host, "tiktok.com") {
 		return ParsedTarget{Type: "user", Value: trimmedTarget}
 	}
 	return ParsedTarget{Type: "user", Value: trimmedTarget}
 }
 
+// applyRateLimits configures the API rate limiter from the request_delay, adaptive_rate_limit, max_request_delay,
+// request_burst, endpoint_delays and shared_rate_limit settings.
+func applyRateLimits(cfg *cliconfig.Config) error {
+	tikwm.RateLimitStateFile = ""
+	if cfg.SharedRateLimit {
+		// Instances using the same database share one budget through a state file next to it.
+		tikwm.RateLimitStateFile = cfg.DatabasePath + ".ratelimit"
+	}
+	delay, err := time.ParseDuration(cfg.RequestDelay)
+	if err != nil {
+		return fmt.Errorf("invalid request_delay '%s': %w", cfg.RequestDelay, err)
+	}
+	tikwm.RequestDelay = delay
+	tikwm.AdaptiveRateLimit = cfg.AdaptiveRateLimit
+	if cfg.AdaptiveRateLimit {
+		maxDelay, err := time.ParseDuration(cfg.MaxRequestDelay)
+		if err != nil {
+			return fmt.Errorf("invalid max_request_delay '%s': %w", cfg.MaxRequestDelay, err)
+		}
+		tikwm.MaxRequestDelay = maxDelay
+	}
+	tikwm.RequestBurst = max(cfg.RequestBurst, 1)
+	tikwm.BudgetDelays = make(map[string]time.Duration, len(cfg.EndpointDelays))
+	for budget, value := range cfg.EndpointDelays {
+		switch budget {
+		case tikwm.BudgetFeed, tikwm.BudgetPost, tikwm.BudgetSource:
+		default:
+			return fmt.Errorf("invalid endpoint_delays key '%s', must be '%s', '%s' or '%s'", budget, tikwm.BudgetFeed, tikwm.BudgetPost, tikwm.BudgetSource)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint_delays value for '%s': %w", budget, err)
+		}
+		tikwm.BudgetDelays[budget] = d
+	}
+	return nil
+}
+
+// apiKeysEnv is the environment variable holding comma-separated API keys, which takes precedence over api_keys.
+const apiKeysEnv = "TIKWM_API_KEYS"
+
+// apiKeys returns the API keys to send requests with, from the environment or the config.
+func apiKeys(cfg *cliconfig.Config) []string {
+	if env := os.Getenv(apiKeysEnv); strings.TrimSpace(env) != "" {
+		return strings.Split(env, ",")
+	}
+	return cfg.APIKeys
+}
+
+// setupTraffic installs the transport that records API traffic to the --record directory, or replays it from the
+// --replay directory, and reports whether traffic is replayed. Usernames and the download path are redacted from
+// recordings so that they can be shared. Video IDs are kept, as a replay needs them to tell posts apart.
+func setupTraffic(cmd *cobra.Command, cfg *cliconfig.Config, targets []string) (bool, error) {
+	recordDir, _ := cmd.Flags().GetString("record")
+	replayDir, _ := cmd.Flags().GetString("replay")
+	if recordDir == "" && replayDir == "" {
+		return false, nil
+	}
+	if recordDir != "" && replayDir != "" {
+		return false, errors.New("--record and --replay cannot be used together")
+	}
+	redact := logging.NewRedactor(cfg.DownloadPath, targets, false).Redact
+	if replayDir != "" {
+		transport, err := tikwm.NewReplayTransport(replayDir, redact)
+		if err != nil {
+			return false, fmt.Errorf("failed to load recorded API traffic: %w", err)
+		}
+		network.SetGlobalTransport(transport)
+		return true, nil
+	}
+	next := http.DefaultClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	transport, err := tikwm.NewRecordingTransport(recordDir, next, redact)
+	if err != nil {
+		return false, err
+	}
+	network.SetGlobalTransport(transport)
+	return false, nil
+}
+
+// applyReplay adjusts the configuration for a replay: recorded responses need no rate limit, and media
+// is not recorded, so downloads are empty files that cannot be validated.
+func applyReplay(cfg *cliconfig.Config) {
+	tikwm.RequestDelay = 0
+	tikwm.AdaptiveRateLimit = false
+	tikwm.RateLimitStateFile = ""
+	tikwm.BudgetDelays = map[string]time.Duration{}
+	cfg.FfmpegPath = ""
+}
+
+// reportRequestDelay logs changes of the delay between API requests made by the adaptive rate limit,
+// and tells the user when requests are slowed down and when they are back to the configured rate.
+func reportRequestDelay(previous, delay time.Duration) {
+	fileLogger.Printf("Delay between API requests changed from %s to %s (configured: %s).", previous, delay, tikwm.RequestDelay)
+	switch {
+	case delay > previous:
+		console.Warn("Rate-limited by tikwm, slowing down to 1 API request every %s.", delay)
+	case delay <= tikwm.RequestDelay:
+		console.Info("No longer rate-limited, back to 1 API request every %s.", delay)
+	}
+}
+
+// reportQuotaRotation tells the user that requests moved on from a bind address or API key that is close to its daily quota.
+func reportQuotaRotation(identity string, requests int) {
+	fileLogger.Printf("%s has sent %d API requests today, within %d of the daily quota. Rotating to the next one.", identity, requests, cfg.QuotaReserve)
+	console.Info("%s is close to its daily quota (%d requests today), rotating to the next one.", identity, requests)
+}
+
+// reportFallbacks prints a summary of the videos that were downloaded in a lower rung of the quality ladder
+// than the best one, or in none at all, since the last summary. Each fallback is detailed in the log file.
+func reportFallbacks() {
+	fallbacks := appClient.TakeFallbacks()
+	if len(fallbacks) == 0 {
+		return
+	}
+	wanted := fallbacks[0].Wanted
+	counts := make(map[tikwm.AssetType]int)
+	var failed []string
+	for _, fallback := range fallbacks {
+		fileLogger.Printf("Quality fallback for post %s: wanted %s, got %q: %v", fallback.PostID, fallback.Wanted, fallback.Got, fallback.Err)
+		if fallback.Got == "" {
+			failed = append(failed, fallback.PostID)
+			continue
+		}
+		counts[fallback.Got]++
+	}
+	if len(failed) < len(fallbacks) {
+		var parts []string
+		for _, quality := range []tikwm.AssetType{tikwm.AssetSource, tikwm.AssetHD, tikwm.AssetSD, tikwm.AssetWatermarked} {
+			if counts[quality] > 0 {
+				parts = append(parts, fmt.Sprintf("%d in %s", counts[quality], quality))
+			}
+		}
+		console.Warn("%d video(s) could not be downloaded in %s quality and fell back: %s. Run 'tikwm fix' to try again later.",
+			len(fallbacks)-len(failed), wanted, strings.Join(parts, ", "))
+	}
+	if len(failed) > 0 {
+		console.Error("%d video(s) could not be downloaded in any quality of '%s': %s", len(failed), cfg.Quality, strings.Join(failed, ", "))
+	}
+}
+
+// clearFeedCheckpoints deletes the saved checkpoints of user and hashtag targets, so that their feeds are crawled from the beginning.
+func clearFeedCheckpoints(targets []string) {
+	for _, target := range targets {
+		parsed := parseTarget(target)
+		var err error
+		switch parsed.Type {
+		case "user":
+			err = appClient.ClearProfileCheckpoint(parsed.Value)
+		case "hashtag":
+			err = appClient.ClearHashtagCheckpoint(parsed.Value)
+		}
+		if err != nil {
+			console.Warn("Could not clear checkpoint for '%s': %v", target, err)
+		}
+	}
+}
+
 // processTargetWithContext processes a single target, either downloading a post or a user's profile.
 func processTargetWithContext(ctx context.Context, target ParsedTarget, appClient *client.Client, logger *log.Logger, console *cli.Console, force bool) error {
 	var taskID string
@@ -154,6 +350,38 @@ func processTargetWithContext(ctx context.Context, target ParsedTarget, appClien
 		}
 		err = appClient.DownloadProfile(ctx, username, force, logger, progressCb)
 
+	case "hashtag":
+		taskID = "#" + client.ExtractHashtag(target.Value)
+		console.AddTask(taskID, "Preparing to fetch...", cli.OpFeedFetch)
+
+		progressCb := func(current, total int, msg string) {
+			console.UpdateTaskActivity(taskID)
+			console.UpdateTaskMessage(taskID, fmt.Sprintf("Processing %d/%d: %s", current, total, msg))
+		}
+		err = appClient.DownloadHashtag(ctx, target.Value, force, logger, progressCb)
+
+	case "playlist":
+		playlist, _ := client.ParsePlaylistURL(target.Value)
+		taskID = fmt.Sprintf("%s %s", playlist.Kind, playlist.ID)
+		console.AddTask(taskID, "Preparing to fetch...", cli.OpFeedFetch)
+
+		progressCb := func(current, total int, msg string) {
+			console.UpdateTaskActivity(taskID)
+			console.UpdateTaskMessage(taskID, fmt.Sprintf("Processing %d/%d: %s", current, total, msg))
+		}
+		err = appClient.DownloadPlaylist(ctx, target.Value, force, logger, progressCb)
+
+	case "search":
+		query := strings.TrimSpace(strings.TrimPrefix(target.Value, searchPrefix))
+		taskID = searchPrefix + query
+		console.AddTask(taskID, "Searching...", cli.OpFeedFetch)
+
+		progressCb := func(current, total int, msg string) {
+			console.UpdateTaskActivity(taskID)
+			console.UpdateTaskMessage(taskID, fmt.Sprintf("Processing %d/%d: %s", current, total, msg))
+		}
+		err = appClient.DownloadSearch(ctx, query, force, logger, progressCb)
+
 	default:
 		err = fmt.Errorf("unknown target type for '%s'", target.Value)
 	}
@@ -170,6 +398,23 @@ func processTargetWithContext(ctx context.Context, target ParsedTarget, appClien
 			console.Error("Disk space error processing '%s'. Halting.", target.Value)
 			return err // Propagate fatal error
 		}
+		switch {
+		case errors.Is(err, tikwm.ErrUserNotFound):
+			console.Error("User for target '%s' does not exist.", target.Value)
+			return err
+		case errors.Is(err, tikwm.ErrHashtagNotFound):
+			console.Error("Hashtag for target '%s' does not exist.", target.Value)
+			return err
+		case errors.Is(err, tikwm.ErrPlaylistNotFound):
+			console.Error("Playlist for target '%s' does not exist.", target.Value)
+			return err
+		case errors.Is(err, tikwm.ErrPrivateAccount):
+			console.Error("Account for target '%s' is private.", target.Value)
+			return err
+		case errors.Is(err, tikwm.ErrPostNotFound):
+			console.Error("Post '%s' could not be found.", target.Value)
+			return err
+		}
 		console.Error("Failed to process target '%s': %v", target.Value, err)
 		// Log the error, but return nil so other workers in a static pool can continue.
 		// The dynamic manager will handle the returned error differently.
@@ -227,7 +472,7 @@ func manageTargetsFile(targetLine, targetType, filePath string, console *cli.Con
 	case "post":
 		lines[targetIdx] = "# " + lines[targetIdx]
 		newLines = lines
-	case "user":
+	case "user", "hashtag", "playlist", "search":
 		userLine := lines[targetIdx]
 		tempLines := append(lines[:targetIdx], lines[targetIdx+1:]...)
 		for len(tempLines) > 0 && strings.TrimSpace(tempLines[len(tempLines)-1]) == "" {
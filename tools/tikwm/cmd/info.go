@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
 	"github.com/perpetuallyhorni/tikwm/pkg/client"
 	"github.com/spf13/cobra"
 )
@@ -13,7 +12,9 @@ import (
 var infoCmd = &cobra.Command{
 	Use:   "info [targets...]",
 	Short: "Print info about user profiles.",
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Print info about user profiles. The follower, following, like and video counts of each profile
+are recorded in the database every time, so that 'tikwm stats' can show how the creator grows.`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Iterate over the provided target usernames or URLs.
 		for _, target := range args {
@@ -21,8 +22,8 @@ var infoCmd = &cobra.Command{
 			username := client.ExtractUsername(target)
 			// Print a message indicating that we are fetching information for the user.
 			console.Info("Fetching info for %s...", username)
-			// Get the user details.
-			info, err := tikwm.GetUserDetail(username)
+			// Get the user details, recording a snapshot of their stats for 'tikwm stats'.
+			info, err := appClient.GetUserDetail(cmd.Context(), username)
 			// If there is an error getting user details, return an error.
 			if err != nil {
 				return fmt.Errorf("failed to get user details for %s: %w", username, err)
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/network"
+	"github.com/spf13/cobra"
+)
+
+// quotaCmd represents the quota command.
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Show today's API usage and when the daily limit resets.",
+	Long: `Show the API requests sent today from each bind address or with each API key,
+against the daily quota, and when the count or an exhausted address or key resets.
+Requests from every tikwm instance that uses the same database are counted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		usage, err := database.GetQuotaUsage(network.QuotaDay(now.Add(-network.QuotaResetAfter)))
+		if err != nil {
+			return err
+		}
+
+		// Show the configured identities first, then any others that were used recently.
+		identities := network.QuotaIdentities()
+		requests := make(map[string]int)
+		exhaustedAt := make(map[string]time.Time)
+		for _, u := range usage {
+			if !slices.Contains(identities, u.Identity) {
+				identities = append(identities, u.Identity)
+			}
+			if u.Day == network.QuotaDay(now) {
+				requests[u.Identity] = u.Requests
+			}
+			if !u.ExhaustedAt.IsZero() && now.Sub(u.ExhaustedAt) < network.QuotaResetAfter {
+				exhaustedAt[u.Identity] = u.ExhaustedAt
+			}
+		}
+
+		limit := network.QuotaLimit()
+		// The count starts over at midnight UTC.
+		nextDay := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Local()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "IDENTITY\tTODAY\tSTATUS\tRESETS")
+		for _, identity := range identities {
+			status, resets := "available", nextDay
+			if at, ok := exhaustedAt[identity]; ok {
+				status, resets = "exhausted", at.Add(network.QuotaResetAfter).Local()
+			}
+			used := fmt.Sprint(requests[identity])
+			if limit > 0 {
+				used = fmt.Sprintf("%d/%d", requests[identity], limit)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", identity, used, status, resets.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	},
+}
@@ -7,10 +7,10 @@ import (
 	"log"
 	"os"
 
-	tikwm "github.com/perpetuallyhorni/tikwm/internal"
 	"github.com/perpetuallyhorni/tikwm/pkg/client"
 	"github.com/perpetuallyhorni/tikwm/pkg/network"
 	"github.com/perpetuallyhorni/tikwm/pkg/storage/sqlite"
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
 	"github.com/perpetuallyhorni/tikwm/tools/tikwm/internal/cli"
 	cliconfig "github.com/perpetuallyhorni/tikwm/tools/tikwm/internal/config"
 	"github.com/perpetuallyhorni/tikwm/tools/tikwm/internal/update"
@@ -54,6 +54,8 @@ Run 'tikwm [targets...]' to download content or use a specific command.
 For example:
   tikwm some_user_name --quality hd
   tikwm download https://www.tiktok.com/@some_user_name/video/12345
+  tikwm "#some_hashtag"
+  tikwm "search:some keywords" --since "2024-01-01 00:00:00"
   tikwm fix some_user_name`,
 	Args: cobra.ArbitraryArgs,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
@@ -78,17 +80,27 @@ For example:
 		}
 
 		// The full setup for commands that need it.
+		replaying := false
 		if !isLightweightCmd {
 			// Initialize the network manager with IP rotation.
 			if err := network.InitManager(cfg.BindAddress); err != nil {
 				return err
 			}
+			if err := network.InitKeys(apiKeys(cfg)); err != nil {
+				return err
+			}
 
 			targets := getTargets(cfg, console, args)
 			// Check the flag to clean logs or not.
 			cleanLogs, _ := cmd.Flags().GetBool("clean-logs")
 
+			// Record or replay API traffic if asked to.
 			var err error
+			replaying, err = setupTraffic(cmd, cfg, targets)
+			if err != nil {
+				return err
+			}
+
 			// Setup the file logger
 			fileLogger, err = setupFileLogger(cleanLogs, targets, cfg)
 			if err != nil {
@@ -102,6 +114,13 @@ For example:
 			}
 
 			// Initialize the global rate limiter.
+			if err := applyRateLimits(cfg); err != nil {
+				return err
+			}
+			if replaying {
+				applyReplay(cfg)
+			}
+			tikwm.OnRequestDelayChange = reportRequestDelay
 			tikwm.InitRateLimiter(context.Background())
 
 			// Initialize the database.
@@ -110,6 +129,14 @@ For example:
 				return fmt.Errorf("error initializing database: %w", err)
 			}
 
+			// Count API requests against the daily quota, unless replaying recorded responses.
+			if !replaying {
+				network.OnQuotaReserveReached = reportQuotaRotation
+				if err := network.InitQuota(database, cfg.DailyQuota, cfg.QuotaReserve); err != nil {
+					return err
+				}
+			}
+
 			// Create a new client, passing the database which satisfies the storage.Storer interface.
 			appClient, err = client.New(&cfg.Config, database, fileLogger)
 			if err != nil {
@@ -117,8 +144,8 @@ For example:
 			}
 		}
 
-		// Update Check runs for commands that did the full setup.
-		if !isLightweightCmd && cfg.CheckForUpdates {
+		// Update Check runs for commands that did the full setup, unless replaying offline.
+		if !isLightweightCmd && !replaying && cfg.CheckForUpdates {
 			latestVersion, err := update.CheckForUpdate(version)
 			if err != nil {
 				// Non-fatal, just warn the user.
@@ -198,21 +225,32 @@ func init() {
 	rootCmd.PersistentFlags().StringP("dir", "d", "", "Directory to save files (overrides config)")
 	rootCmd.PersistentFlags().String("targets", "", "Path to a file with a list of targets (overrides config)")
 	rootCmd.PersistentFlags().String("since", "", `Don't download videos earlier than this date (YYYY-MM-DD HH:MM:SS)`)
-	rootCmd.PersistentFlags().StringP("quality", "", "", `Video quality to download ("hd", "sd", "all"). Overrides config.`)
+	rootCmd.PersistentFlags().StringP("quality", "", "", `Video quality to download ("source", "hd", "sd", "wm", "all", or a ladder such as "source>hd>sd"). Overrides config.`)
 	rootCmd.PersistentFlags().IntP("workers", "w", 0, "Number of concurrent workers (overrides config, default: num CPUs)")
 	rootCmd.PersistentFlags().BoolP("force", "f", false, "Force download, ignore existing database entries")
-	rootCmd.PersistentFlags().Bool("retry-on-429", false, "Retry with backoff on rate limit instead of falling back to SD")
+	rootCmd.PersistentFlags().Bool("restart", false, "Ignore saved feed checkpoints and crawl feeds from the beginning")
+	rootCmd.PersistentFlags().Bool("retry-on-429", false, "Retry with backoff on rate limit instead of falling back to the next quality of the ladder")
 	rootCmd.PersistentFlags().Bool("download-covers", false, `Enable downloading of post covers (see --cover-type).`)
 	rootCmd.PersistentFlags().String("cover-type", "", `Cover type to download ("cover", "origin", "dynamic"). Overrides config.`)
 	rootCmd.PersistentFlags().Bool("download-avatars", false, "Enable downloading of user avatars. Overrides config.")
+	rootCmd.PersistentFlags().Bool("download-music", false, "Enable downloading of post music and music covers. Overrides config.")
 	rootCmd.PersistentFlags().Bool("save-post-title", false, "Save post title to a .txt file. Overrides config.")
+	rootCmd.PersistentFlags().Bool("save-comments", false, "Save post comments and replies to a .json file. Overrides config.")
+	rootCmd.PersistentFlags().Bool("save-post-metadata", false, "Save the API payload and download details of each post to a .info.json file. Overrides config.")
 
 	// Network flags
 	rootCmd.PersistentFlags().String("bind", "", "Outbound IP address or interface to bind to (overrides config)")
+	rootCmd.PersistentFlags().String("record", "", "Record every API request and response to this directory, for debugging")
+	rootCmd.PersistentFlags().String("replay", "", "Serve API responses recorded with --record from this directory instead of the network")
+
+	// Feed flags
+	rootCmd.PersistentFlags().String("feed-order", "", `Order in which feed posts are processed ("oldest", "newest"). Overrides config.`)
 
 	// Caching flags
 	rootCmd.PersistentFlags().Bool("feed-cache", false, "Enable or disable caching of user feeds. Overrides config.")
 	rootCmd.PersistentFlags().String("feed-cache-ttl", "", `Time-to-live for feed cache, e.g., "1h", "30m". Overrides config.`)
+	rootCmd.PersistentFlags().Bool("incremental-sync", false, "Only page through feeds until already cached posts are reached. Overrides config.")
+	rootCmd.PersistentFlags().Bool("full-rescan", false, "Page through whole feeds, ignoring the feed cache and incremental sync")
 
 	// Daemon flags
 	rootCmd.PersistentFlags().Bool("daemon", false, "Enable daemon mode for continuous, low-frequency polling. Overrides config.")
@@ -221,11 +259,14 @@ func init() {
 	// Add subcommands.
 	rootCmd.AddCommand(downloadCmd)
 	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(searchCmd)
 	rootCmd.AddCommand(editCmd)
 	rootCmd.AddCommand(coversCmd)
 	rootCmd.AddCommand(fixCmd)
 	rootCmd.AddCommand(debugCmd)
 	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(quotaCmd)
+	rootCmd.AddCommand(statsCmd)
 }
 
 // Execute executes the root command.
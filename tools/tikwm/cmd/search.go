@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/tikwm"
+	"github.com/spf13/cobra"
+)
+
+// searchCmd represents the search command.
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Preview the posts a keyword search would download.",
+	Long: `Pages through the search feed for a query and lists the matching posts, applying --since as a filter.
+Nothing is downloaded. To download the results, use a 'search:<query>' target, e.g. tikwm "search:some keywords".`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := strings.Join(args, " ")
+		limit, _ := cmd.Flags().GetInt("limit")
+		since, err := time.Parse(time.DateTime, cfg.Since)
+		if err != nil {
+			return fmt.Errorf("invalid since date format: %w", err)
+		}
+
+		found := 0
+		opt := &tikwm.FeedOpt{
+			// Search results are not ordered by date, so --since filters posts instead of ending the search.
+			Filter: func(post *tikwm.Post) bool {
+				if !tikwm.WhileAfter(since)(post) {
+					return false
+				}
+				found++
+				return true
+			},
+			While: func(post *tikwm.Post) bool {
+				return limit <= 0 || found < limit
+			},
+			OnError: func(err error) {
+				fileLogger.Printf("Error during search for '%s': %v", query, err)
+			},
+		}
+
+		console.Info("Searching for '%s'...", query)
+		posts, err := appClient.Search(cmd.Context(), query, opt)
+		if err != nil && len(posts) == 0 {
+			return fmt.Errorf("search for '%s' failed: %w", query, err)
+		}
+		for _, post := range posts {
+			title := strings.Join(strings.Fields(post.Title), " ")
+			if runes := []rune(title); len(runes) > 60 {
+				title = string(runes[:59]) + "…"
+			}
+			fmt.Printf("%s  %-24s  https://www.tiktok.com/@%s/video/%s  %s\n",
+				time.Unix(post.CreateTime, 0).Format(time.DateOnly), "@"+post.Author.UniqueId, post.Author.UniqueId, post.ID(), title)
+		}
+		console.Info("%d post(s) found for '%s'.", len(posts), query)
+		if err != nil {
+			console.Warn("Search stopped early: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	searchCmd.Flags().Int("limit", 50, "Maximum number of posts to list (0 for no limit)")
+}
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perpetuallyhorni/tikwm/pkg/client"
+	"github.com/perpetuallyhorni/tikwm/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// curveWidth is the number of time slots the growth curves are drawn with.
+const curveWidth = 24
+
+// curveLevels are the characters the growth curves are drawn with, from lowest to highest.
+var curveLevels = []rune("▁▂▃▄▅▆▇█")
+
+// statMetric is one counter of a stats series.
+type statMetric struct {
+	name   string // name is the name of the counter in CSV exports, as in the API.
+	header string // header is the heading of the counter in tables.
+	values []int  // values are the counter's value in each snapshot.
+}
+
+// statSeries is the snapshots of the stats of a post or creator, oldest first.
+type statSeries struct {
+	kind    string // kind is "user" or "post".
+	author  string
+	id      string
+	times   []time.Time
+	metrics []statMetric
+}
+
+// growth returns how much a counter of the series grew between its first and last snapshots.
+func (s *statSeries) growth(metric int) int {
+	values := s.metrics[metric].values
+	return values[len(values)-1] - values[0]
+}
+
+// userSeries returns the series of a creator's stats snapshots.
+func userSeries(stats []storage.UserStats) *statSeries {
+	s := &statSeries{kind: "user", author: stats[0].AuthorID, id: stats[0].AuthorID, metrics: []statMetric{
+		{name: "follower_count", header: "FOLLOWERS"},
+		{name: "following_count", header: "FOLLOWING"},
+		{name: "heart_count", header: "LIKES"},
+		{name: "video_count", header: "VIDEOS"},
+		{name: "digg_count", header: "LIKED"},
+	}}
+	for _, snapshot := range stats {
+		s.times = append(s.times, snapshot.ObservedAt)
+		for i, value := range []int{snapshot.FollowerCount, snapshot.FollowingCount, snapshot.HeartCount, snapshot.VideoCount, snapshot.DiggCount} {
+			s.metrics[i].values = append(s.metrics[i].values, value)
+		}
+	}
+	return s
+}
+
+// postSeries returns the series of stats snapshots of each post, given snapshots ordered by post and time.
+func postSeries(stats []storage.PostStats) []*statSeries {
+	var series []*statSeries
+	var s *statSeries
+	for _, snapshot := range stats {
+		if s == nil || s.id != snapshot.PostID {
+			s = &statSeries{kind: "post", author: snapshot.AuthorID, id: snapshot.PostID, metrics: []statMetric{
+				{name: "play_count", header: "PLAYS"},
+				{name: "digg_count", header: "LIKES"},
+				{name: "comment_count", header: "COMMENTS"},
+				{name: "share_count", header: "SHARES"},
+				{name: "collect_count", header: "SAVES"},
+				{name: "download_count", header: "DOWNLOADS"},
+			}}
+			series = append(series, s)
+		}
+		s.times = append(s.times, snapshot.ObservedAt)
+		for i, value := range []int{snapshot.PlayCount, snapshot.DiggCount, snapshot.CommentCount, snapshot.ShareCount, snapshot.CollectCount, snapshot.DownloadCount} {
+			s.metrics[i].values = append(s.metrics[i].values, value)
+		}
+	}
+	return series
+}
+
+// withDelta formats a value along with how much it changed since a previous value.
+func withDelta(value, previous int) string {
+	if value == previous {
+		return strconv.Itoa(value)
+	}
+	return fmt.Sprintf("%d (%+d)", value, value-previous)
+}
+
+// growthCurve draws how a counter of the series evolved between from and to. The period is divided into time slots,
+// each showing the value of the latest snapshot at its end, and slots before the first snapshot are left blank.
+func growthCurve(s *statSeries, metric int, from, to time.Time) string {
+	values := s.metrics[metric].values
+	slots := make([]int, curveWidth)
+	known := make([]bool, curveWidth)
+	lowest, highest := values[len(values)-1], values[len(values)-1]
+	next := 0
+	for i := range slots {
+		end := from.Add(to.Sub(from) * time.Duration(i+1) / curveWidth)
+		for next < len(s.times) && !s.times[next].After(end) {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+		slots[i], known[i] = values[next-1], true
+		lowest, highest = min(lowest, slots[i]), max(highest, slots[i])
+	}
+	var curve strings.Builder
+	for i, value := range slots {
+		switch {
+		case !known[i]:
+			curve.WriteRune(' ')
+		case highest == lowest:
+			curve.WriteRune(curveLevels[0])
+		default:
+			curve.WriteRune(curveLevels[(value-lowest)*(len(curveLevels)-1)/(highest-lowest)])
+		}
+	}
+	return curve.String()
+}
+
+// printSnapshots prints every snapshot of a series with what changed since the previous one,
+// followed by the growth curve of each counter over the period.
+func printSnapshots(out io.Writer, s *statSeries, from, to time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	headers := []string{"OBSERVED"}
+	for _, metric := range s.metrics {
+		headers = append(headers, metric.header)
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for i, at := range s.times {
+		cells := []string{at.Local().Format("2006-01-02 15:04")}
+		for _, metric := range s.metrics {
+			previous := metric.values[max(i-1, 0)]
+			cells = append(cells, withDelta(metric.values[i], previous))
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, metric := range s.metrics {
+		first, last := metric.values[0], metric.values[len(metric.values)-1]
+		change := fmt.Sprintf("%+d", s.growth(i))
+		if first > 0 {
+			change += fmt.Sprintf(" (%+.1f%%)", float64(last-first)*100/float64(first))
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d → %d\t%s\n", strings.ToLower(metric.header), growthCurve(s, i, from, to), first, last, change)
+	}
+	return w.Flush()
+}
+
+// printPostGrowth prints the posts of a creator that grew the most, with how much each counter grew over the period
+// and the growth curve of their plays. top limits the number of posts printed, 0 prints them all.
+func printPostGrowth(out io.Writer, posts []*statSeries, top int, from, to time.Time) error {
+	// Posts that gained the most plays first.
+	slices.SortStableFunc(posts, func(a, b *statSeries) int { return b.growth(0) - a.growth(0) })
+	if top > 0 && len(posts) > top {
+		posts = posts[:top]
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	headers := []string{"POST"}
+	for _, metric := range posts[0].metrics {
+		headers = append(headers, metric.header)
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(append(headers, "PLAYS CURVE"), "\t"))
+	for _, s := range posts {
+		cells := []string{s.id}
+		for _, metric := range s.metrics {
+			cells = append(cells, withDelta(metric.values[len(metric.values)-1], metric.values[0]))
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(append(cells, growthCurve(s, 0, from, to)), "\t"))
+	}
+	return w.Flush()
+}
+
+// exportStats writes every snapshot of the series as CSV, one row per counter and snapshot,
+// with how much the counter changed since the previous snapshot of the series.
+func exportStats(out io.Writer, series []*statSeries) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"kind", "author", "id", "observed_at", "metric", "value", "delta"}); err != nil {
+		return err
+	}
+	for _, s := range series {
+		for i, at := range s.times {
+			for _, metric := range s.metrics {
+				delta := ""
+				if i > 0 {
+					delta = strconv.Itoa(metric.values[i] - metric.values[i-1])
+				}
+				row := []string{s.kind, s.author, s.id, at.UTC().Format(time.RFC3339), metric.name, strconv.Itoa(metric.values[i]), delta}
+				if err := w.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// postIDFromURL returns the ID of the post a video URL points to, or "" if it has none.
+func postIDFromURL(target string) string {
+	_, rest, found := strings.Cut(target, "/video/")
+	if !found {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "?")
+	return strings.Trim(id, "/")
+}
+
+// statsCmd represents the stats command.
+var statsCmd = &cobra.Command{
+	Use:   "stats [targets...]",
+	Short: "Show how the engagement of creators and posts grew over time.",
+	Long: `Show how the stats of creators and their posts grew over time, from the snapshots recorded in the database.
+The play, like, comment, share and save counts of posts are recorded whenever a feed or post is fetched,
+and the follower, like and video counts of creators whenever 'tikwm info' is run. A snapshot is only
+recorded when a count changed, so each count holds until the next snapshot.
+
+Targets are usernames or post URLs. For a creator, the profile snapshots are listed along with the posts
+that grew the most; for a post, every snapshot is listed. Without targets, the targets file is used.
+Use --csv to export the snapshots instead, one row per count and snapshot.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		days, _ := cmd.Flags().GetInt("days")
+		top, _ := cmd.Flags().GetInt("top")
+		csvPath, _ := cmd.Flags().GetString("csv")
+		if days <= 0 {
+			return fmt.Errorf("--days must be positive, got %d", days)
+		}
+		to := time.Now()
+		from := to.AddDate(0, 0, -days)
+
+		var series []*statSeries
+		for _, target := range getTargets(cfg, console, args) {
+			parsed := parseTarget(target)
+			switch parsed.Type {
+			case "user":
+				username := client.ExtractUsername(parsed.Value)
+				userStats, err := database.GetUserStats(username, from)
+				if err != nil {
+					return err
+				}
+				postStats, err := database.GetPostStatsByAuthor(username, from)
+				if err != nil {
+					return err
+				}
+				posts := postSeries(postStats)
+				var user *statSeries
+				if len(userStats) > 0 {
+					user = userSeries(userStats)
+					series = append(series, user)
+				}
+				series = append(series, posts...)
+				if csvPath != "" {
+					continue
+				}
+
+				fmt.Printf("@%s\n\n", username)
+				if user != nil {
+					if err := printSnapshots(os.Stdout, user, from, to); err != nil {
+						return err
+					}
+				} else {
+					console.Info("No profile stats recorded for %s. Run 'tikwm info %s' to record them.", username, username)
+				}
+				if len(posts) > 0 {
+					fmt.Println()
+					if err := printPostGrowth(os.Stdout, posts, top, from, to); err != nil {
+						return err
+					}
+				} else {
+					console.Info("No post stats recorded for %s in the last %d days. Download the profile to record them.", username, days)
+				}
+				fmt.Println()
+			case "post":
+				postID := postIDFromURL(parsed.Value)
+				if postID == "" {
+					console.Warn("Skipping %s: no post ID found in the URL.", target)
+					continue
+				}
+				postStats, err := database.GetPostStats(postID, from)
+				if err != nil {
+					return err
+				}
+				if len(postStats) == 0 {
+					console.Info("No stats recorded for post %s in the last %d days.", postID, days)
+					continue
+				}
+				post := postSeries(postStats)[0]
+				series = append(series, post)
+				if csvPath != "" {
+					continue
+				}
+
+				fmt.Printf("@%s post %s\n\n", post.author, postID)
+				if err := printSnapshots(os.Stdout, post, from, to); err != nil {
+					return err
+				}
+				fmt.Println()
+			default:
+				console.Warn("Skipping %s: stats are only tracked for creators and posts.", target)
+			}
+		}
+
+		if csvPath == "" {
+			return nil
+		}
+		if csvPath == "-" {
+			return exportStats(os.Stdout, series)
+		}
+		// #nosec G304
+		file, err := os.Create(csvPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", csvPath, err)
+		}
+		if err := exportStats(file, series); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("failed to write %s: %w", csvPath, err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", csvPath, err)
+		}
+		console.Success("Exported the stats of %d creator(s) and post(s) to %s.", len(series), csvPath)
+		return nil
+	},
+}
+
+func init() {
+	statsCmd.Flags().Int("days", 30, "Number of days of history to show")
+	statsCmd.Flags().Int("top", 10, "Number of posts to list per creator, those that gained the most plays first (0 for all)")
+	statsCmd.Flags().String("csv", "", "Export the snapshots to a CSV file instead of printing them ('-' for stdout)")
+}
@@ -28,6 +28,7 @@ type Config struct {
 	MaxWorkers         int    `koanf:"max_workers"`       // Maximum number of concurrent workers.
 	DaemonMode         bool   `koanf:"daemon_mode"`
 	DaemonPollInterval string `koanf:"daemon_poll_interval"`
+	SharedRateLimit    bool   `koanf:"shared_rate_limit"` // Share the API rate limit with other instances using the same database.
 }
 
 // Default returns the default CLI configuration.
@@ -52,6 +53,7 @@ func Default() (*Config, error) {
 		MaxWorkers:         runtime.NumCPU(),
 		DaemonMode:         false,
 		DaemonPollInterval: "60s",
+		SharedRateLimit:    false,
 	}, nil
 }
 
@@ -115,7 +117,9 @@ database_path: "%s"
 # API calls are still sequential (1/sec), but downloads can be parallel.
 # Defaults to the number of CPU cores.
 max_workers: %d
-# Quality to download videos in. Options: "source", "hd", "sd", "all".
+# Quality to download videos in. Options: "source", "hd", "sd", "wm" (watermarked), "all",
+# or a ladder of qualities from best to worst, such as "source>hd>sd", to download each video
+# in the best quality that succeeds. 'tikwm fix' upgrades videos that fell back to a lower one.
 quality: "%s"
 # Default date to download content since (YYYY-MM-DD HH:MM:SS).
 since: "%s"
@@ -128,11 +132,25 @@ download_covers: %t
 cover_type: "%s"
 # Set to true to download user profile avatars.
 download_avatars: %t
+# Set to true to download the music (sound) used by posts, along with its cover.
+# Each track is stored once in the "_music" directory and linked to every post that uses it.
+download_music: %t
 # Set to true to save the post title to a .txt file.
 save_post_title: %t
-# When rate-limited (429) on an HD link, retry with backoff or fall back to SD?
-# Set to true to retry with backoff, false to fall back to SD.
+# Set to true to save post comments, including reply threads and like counts, to a _comments.json file.
+# Comments are refreshed on later runs when the post's comment count changes; media is not re-downloaded.
+save_comments: %t
+# Set to true to save each post's full API payload (stats, music, author, region...) to a .info.json file,
+# along with the assets downloaded for it, their SHA-256 hashes and download times.
+# The file is refreshed on later runs when the post's stats change.
+save_post_metadata: %t
+# When rate-limited (429) on a video link, retry with backoff or give up on that quality?
+# Set to true to retry with backoff, false to fall back to the next quality of the ladder.
 retry_on_429: %t
+# Number of upcoming videos whose "source" quality encode is requested ahead of their download,
+# so that the API encodes them while earlier videos are downloading. 0 (the default) requests each encode
+# only when its video is downloaded.
+source_prefetch: %d
 # Path to the ffmpeg executable. Used to validate downloaded videos.
 ffmpeg_path: "%s"
 
@@ -140,12 +158,56 @@ ffmpeg_path: "%s"
 # Specify the local IP address or network interface name for outbound connections.
 # Leave blank to let the OS decide. Examples: "192.168.1.100", "eth0"
 bind_address: "%s"
+# tikwm API keys, for plans with higher limits than anonymous requests. When a key hits its daily limit,
+# requests move on to the next one. Keys can also be given in the TIKWM_API_KEYS environment variable,
+# separated by commas, which takes precedence. Example: ["key1", "key2"]
+api_keys: []
+# Number of API requests tikwm allows per IP address or API key and day. Requests are counted in the database,
+# see 'tikwm quota'. Set to 0 if unknown, to only rotate once tikwm reports the limit.
+daily_quota: %d
+# Number of requests of the daily quota to leave unused before rotating to the next bind address or API key.
+quota_reserve: %d
+# Minimum delay between API requests. tikwm allows about one request per second.
+request_delay: "%s"
+# Set to true to slow all requests down together when tikwm starts rate-limiting them,
+# and to speed them back up to request_delay once requests succeed again.
+adaptive_rate_limit: %t
+# Longest delay between API requests that the adaptive rate limit slows down to.
+max_request_delay: "%s"
+# Number of API requests that may be sent back to back after a pause. Keep it at 1 unless your API plan allows bursts.
+request_burst: %d
+# Minimum delay between requests of each kind, on top of request_delay, so that one kind cannot starve the others.
+# Kinds: "feed" (feed and comment paging), "post" (post and profile lookups), "source" (source encode requests).
+# Example: {source: "3s"}
+endpoint_delays: {}
+# Set to true to share the rate limit with other tikwm instances on this machine that use the same database,
+# e.g. a daemon and an ad-hoc download, so that together they stay within tikwm's limit instead of getting
+# rate-limited. The instances coordinate through a "<database_path>.ratelimit" file.
+shared_rate_limit: %t
+
+# Feeds
+# Order in which the posts of a feed are processed. Options:
+# "oldest": Fetch the whole feed first, then download from the oldest post to the newest.
+#           The whole feed is held in memory until it has been fetched, which adds up for large profiles.
+# "newest": Download from the newest post to the oldest while the feed is still being fetched.
+feed_order: "%s"
+# Number of posts at the top of a profile that may be older than "since" without ending the feed.
+# Pinned posts are listed first even when they are old; posts flagged as pinned by the API are always skipped.
+pinned_tolerance: %d
 
 # Caching
-# Enable caching of user feeds to speed up repeated runs.
+# Enable caching of user feeds to speed up repeated runs. Feeds are cached in the database.
 feed_cache: %t
 # How long to keep feed cache before it's considered stale (e.g., "1h", "30m", "2h15m").
 feed_cache_ttl: "%s"
+# Set to true to only page through feeds until posts that are already cached are reached,
+# instead of paging through whole feeds once the cache is stale. Recommended for daemon mode.
+incremental_sync: %t
+# Number of consecutive cached posts to read past the first one before an incremental sync stops.
+# Keep it above the number of pinned posts a profile can have (3).
+sync_overlap: %d
+# How often feeds synced incrementally are paged through entirely, to pick up older posts and drop deleted ones.
+full_rescan_interval: "%s"
 
 # Daemon Mode (for use with targets file)
 # When enabled, the app will run continuously and poll for new content at a reduced rate after a full pass.
@@ -160,7 +222,7 @@ editor: "%s"
 check_for_updates: %t
 # Automatically install new versions of tikwm. If false, you will be notified to run 'tikwm update'.
 auto_update: %t
-`, cfg.DownloadPath, cfg.TargetsFile, cfg.DatabasePath, cfg.MaxWorkers, cfg.Quality, cfg.Since, cfg.DownloadCovers, cfg.CoverType, cfg.DownloadAvatars, cfg.SavePostTitle, cfg.RetryOn429, cfg.FfmpegPath, cfg.BindAddress, cfg.FeedCache, cfg.FeedCacheTTL, cfg.DaemonMode, cfg.DaemonPollInterval, cfg.Editor, cfg.CheckForUpdates, cfg.AutoUpdate)
+`, cfg.DownloadPath, cfg.TargetsFile, cfg.DatabasePath, cfg.MaxWorkers, cfg.Quality, cfg.Since, cfg.DownloadCovers, cfg.CoverType, cfg.DownloadAvatars, cfg.DownloadMusic, cfg.SavePostTitle, cfg.SaveComments, cfg.SavePostMetadata, cfg.RetryOn429, cfg.SourcePrefetch, cfg.FfmpegPath, cfg.BindAddress, cfg.DailyQuota, cfg.QuotaReserve, cfg.RequestDelay, cfg.AdaptiveRateLimit, cfg.MaxRequestDelay, cfg.RequestBurst, cfg.SharedRateLimit, cfg.FeedOrder, cfg.PinnedTolerance, cfg.FeedCache, cfg.FeedCacheTTL, cfg.IncrementalSync, cfg.SyncOverlap, cfg.FullRescanInterval, cfg.DaemonMode, cfg.DaemonPollInterval, cfg.Editor, cfg.CheckForUpdates, cfg.AutoUpdate)
 	content = strings.ReplaceAll(content, "\\", "/")
 	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
 		return fmt.Errorf("failed to write default config file: %w", err)